@@ -0,0 +1,140 @@
+// Package auth issues and verifies the bearer tokens of the API. Tokens are
+// JWTs signed with HS256 or RS256, usually with keys read from local files;
+// they carry the user name as subject and the user's role.
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for a token that is malformed, expired or not
+// signed with one of the configured keys.
+var ErrInvalidToken = errors.New("invalid token")
+
+// The signing algorithms tokens can use.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// Claims is the payload of a token.
+type Claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Options configures Tokens. Algorithm picks the key new tokens are signed
+// with; tokens signed with either configured key are accepted, so the
+// algorithm can be switched without logging everyone out.
+type Options struct {
+	Algorithm string
+	HMACKey   []byte
+	RSAKey    *rsa.PrivateKey
+	Issuer    string
+	TTL       time.Duration
+}
+
+// Tokens issues and verifies tokens.
+type Tokens struct {
+	method  jwt.SigningMethod
+	hmacKey []byte
+	rsaKey  *rsa.PrivateKey
+	issuer  string
+	ttl     time.Duration
+}
+
+func NewTokens(o Options) (*Tokens, error) {
+	t := &Tokens{hmacKey: o.HMACKey, rsaKey: o.RSAKey, issuer: o.Issuer, ttl: o.TTL}
+
+	if len(o.HMACKey) > 0 && len(o.HMACKey) < 32 {
+		return nil, fmt.Errorf("auth: HMAC key must be at least 32 bytes, got %d", len(o.HMACKey))
+	}
+
+	switch o.Algorithm {
+	case HS256:
+		if len(o.HMACKey) == 0 {
+			return nil, errors.New("auth: HS256 needs an HMAC key")
+		}
+		t.method = jwt.SigningMethodHS256
+	case RS256:
+		if o.RSAKey == nil {
+			return nil, errors.New("auth: RS256 needs an RSA key")
+		}
+		t.method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("auth: unknown algorithm %q", o.Algorithm)
+	}
+	if o.TTL <= 0 {
+		return nil, errors.New("auth: token lifetime must be positive")
+	}
+	return t, nil
+}
+
+// Issue returns a token for subject with role and the time it expires.
+func (t *Tokens) Issue(subject, role string) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(t.ttl)
+	claims := Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.issuer,
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+
+	var key any = t.hmacKey
+	if t.method == jwt.SigningMethodRS256 {
+		key = t.rsaKey
+	}
+	signed, err := jwt.NewWithClaims(t.method, claims).SignedString(key)
+	return signed, expires, err
+}
+
+// Verify checks the signature, issuer and expiry of token and returns its
+// claims. The key is picked by the algorithm in the token header, and each
+// key only verifies its own algorithm, so an RS256 public key can never be
+// used as an HMAC secret.
+func (t *Tokens) Verify(token string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		switch {
+		case token.Method == jwt.SigningMethodHS256 && len(t.hmacKey) > 0:
+			return t.hmacKey, nil
+		case token.Method == jwt.SigningMethodRS256 && t.rsaKey != nil:
+			return &t.rsaKey.PublicKey, nil
+		}
+		return nil, fmt.Errorf("no key for algorithm %s", token.Method.Alg())
+	},
+		jwt.WithValidMethods([]string{HS256, RS256}),
+		jwt.WithIssuer(t.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return &claims, nil
+}
+
+type claimsKey struct{}
+
+// WithClaims returns a context carrying the claims of the request's token.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom returns the claims set by WithClaims.
+func ClaimsFrom(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrBadCredentials is returned for an unknown user name or a wrong password;
+// the two are not told apart.
+var ErrBadCredentials = errors.New("invalid username or password")
+
+// The roles a user can have. What each may do is decided by the policy of
+// the handler package.
+const (
+	RoleAnalyst       = "analyst"
+	RoleFieldAgent    = "field_agent"
+	RoleQuartermaster = "quartermaster"
+	RoleAdmin         = "admin"
+)
+
+// Roles lists every role.
+var Roles = []string{RoleAnalyst, RoleFieldAgent, RoleQuartermaster, RoleAdmin}
+
+// User is an account that can log in.
+type User struct {
+	Username string
+	// PasswordHash is a bcrypt hash, see HashPassword.
+	PasswordHash string
+	Role         string
+}
+
+// Users holds the accounts by user name.
+type Users map[string]User
+
+// NewUsers indexes users by name. Every user needs one of the Roles.
+func NewUsers(users []User) (Users, error) {
+	byName := Users{}
+	for _, u := range users {
+		if !slices.Contains(Roles, u.Role) {
+			return nil, fmt.Errorf("auth: user %q has unknown role %q", u.Username, u.Role)
+		}
+		byName[u.Username] = u
+	}
+	return byName, nil
+}
+
+// dummyHash is compared against for unknown users, so that a login takes
+// about as long whether or not the user exists.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Authenticate returns the user with username if password is theirs.
+func (us Users) Authenticate(username, password string) (User, error) {
+	user, ok := us[username]
+	hash := []byte(user.PasswordHash)
+	if !ok {
+		hash = dummyHash()
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok {
+		return User{}, ErrBadCredentials
+	}
+	return user, nil
+}
+
+// HashPassword returns the bcrypt hash to put in a User's PasswordHash.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
@@ -0,0 +1,405 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything the binary can be configured with. Values are
+// resolved in increasing order of precedence: defaults, the config file,
+// NGC4_* environment variables and finally command line flags.
+type Config struct {
+	Storage           string   `json:"storage"`
+	DB                DBConfig `json:"db"`
+	ListenAddr        string   `json:"listen_addr"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	ReadTimeout       Duration `json:"read_timeout"`
+	WriteTimeout      Duration `json:"write_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout"`
+	ShutdownTimeout   Duration `json:"shutdown_timeout"`
+	LogLevel          string   `json:"log_level"`
+	ItemCode          ItemCode `json:"item_code"`
+	// StockAlertWebhook, when set, receives a POST for every item whose
+	// stock drops below its reorder threshold. Alerts are logged either way.
+	StockAlertWebhook string `json:"stock_alert_webhook"`
+	Auth              Auth   `json:"auth"`
+}
+
+// Auth configures the bearer tokens the API requires. Users can only be
+// listed in the config file; for local development HMACKey and
+// AdminPasswordHash set from the environment are enough to log in.
+type Auth struct {
+	// Algorithm is HS256 or RS256, the one new tokens are signed with.
+	Algorithm   string `json:"algorithm"`
+	HMACKeyFile string `json:"hmac_key_file"`
+	// HMACKey is the HS256 secret itself, in place of HMACKeyFile.
+	HMACKey    string   `json:"hmac_key"`
+	RSAKeyFile string   `json:"rsa_key_file"`
+	Issuer     string   `json:"issuer"`
+	TokenTTL   Duration `json:"token_ttl"`
+	Users      []User   `json:"users"`
+	// AdminPasswordHash, when set, adds a user named admin with the admin
+	// role to Users.
+	AdminPasswordHash string `json:"admin_password_hash"`
+}
+
+// User is an account that can log in. PasswordHash is a bcrypt hash as
+// printed by `ngc4 hash-password`.
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Role         string `json:"role"`
+}
+
+// ItemCode configures the codes generated for items created without one:
+// Prefix followed by a sequence number zero-padded to Width digits, e.g.
+// CODE011.
+type ItemCode struct {
+	Prefix string `json:"prefix"`
+	Width  int    `json:"width"`
+}
+
+func Default() Config {
+	return Config{
+		Storage:           "mysql",
+		DB:                DBConfig{Pool: DefaultPool},
+		ListenAddr:        "localhost:8080",
+		ReadHeaderTimeout: Duration(5 * time.Second),
+		ReadTimeout:       Duration(10 * time.Second),
+		WriteTimeout:      Duration(30 * time.Second),
+		IdleTimeout:       Duration(2 * time.Minute),
+		ShutdownTimeout:   Duration(20 * time.Second),
+		LogLevel:          "info",
+		ItemCode:          ItemCode{Prefix: "CODE", Width: 3},
+		Auth:              Auth{Algorithm: "HS256", Issuer: "ngc4", TokenTTL: Duration(time.Hour)},
+	}
+}
+
+// Duration is a time.Duration written as "30s" or "5m" in config files.
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// setting is one configuration value that can come from the environment or
+// a flag. set parses the raw string into the config.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	get   func(c *Config) string
+	set   func(c *Config, v string) error
+}
+
+func stringSetting(flag, env, usage string, field func(c *Config) *string) setting {
+	return setting{flag, env, usage,
+		func(c *Config) string { return *field(c) },
+		func(c *Config, v string) error { *field(c) = v; return nil },
+	}
+}
+
+func intSetting(flag, env, usage string, field func(c *Config) *int) setting {
+	return setting{flag, env, usage,
+		func(c *Config) string { return strconv.Itoa(*field(c)) },
+		func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("not a number: %q", v)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func durationSetting(flag, env, usage string, field func(c *Config) *Duration) setting {
+	return setting{flag, env, usage,
+		func(c *Config) string { return field(c).String() },
+		func(c *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			*field(c) = Duration(d)
+			return nil
+		},
+	}
+}
+
+var settings = []setting{
+	stringSetting("storage", "NGC4_STORAGE", "storage backend: mysql, postgres, sqlite or memory", func(c *Config) *string { return &c.Storage }),
+	stringSetting("db-dsn", "NGC4_DB_DSN", "database data source name; overrides the other -db-* connection settings", func(c *Config) *string { return &c.DB.DSN }),
+	stringSetting("db-host", "NGC4_DB_HOST", "database host (default 127.0.0.1)", func(c *Config) *string { return &c.DB.Host }),
+	intSetting("db-port", "NGC4_DB_PORT", "database port (default depends on -storage)", func(c *Config) *int { return &c.DB.Port }),
+	stringSetting("db-user", "NGC4_DB_USER", "database user (default depends on -storage)", func(c *Config) *string { return &c.DB.User }),
+	stringSetting("db-password", "NGC4_DB_PASSWORD", "database password", func(c *Config) *string { return &c.DB.Password }),
+	stringSetting("db-name", "NGC4_DB_NAME", "database name, or file name for sqlite (default depends on -storage)", func(c *Config) *string { return &c.DB.Name }),
+	intSetting("db-max-open", "NGC4_DB_MAX_OPEN_CONNS", "maximum open database connections", func(c *Config) *int { return &c.DB.Pool.MaxOpenConns }),
+	intSetting("db-max-idle", "NGC4_DB_MAX_IDLE_CONNS", "maximum idle database connections", func(c *Config) *int { return &c.DB.Pool.MaxIdleConns }),
+	durationSetting("db-conn-lifetime", "NGC4_DB_CONN_MAX_LIFETIME", "maximum lifetime of a database connection", func(c *Config) *Duration { return &c.DB.Pool.ConnMaxLifetime }),
+	durationSetting("db-conn-idle-time", "NGC4_DB_CONN_MAX_IDLE_TIME", "maximum idle time of a database connection", func(c *Config) *Duration { return &c.DB.Pool.ConnMaxIdleTime }),
+	stringSetting("listen", "NGC4_LISTEN_ADDR", "HTTP listen address", func(c *Config) *string { return &c.ListenAddr }),
+	durationSetting("read-header-timeout", "NGC4_READ_HEADER_TIMEOUT", "maximum time to read request headers", func(c *Config) *Duration { return &c.ReadHeaderTimeout }),
+	durationSetting("read-timeout", "NGC4_READ_TIMEOUT", "maximum time to read a request", func(c *Config) *Duration { return &c.ReadTimeout }),
+	durationSetting("write-timeout", "NGC4_WRITE_TIMEOUT", "maximum time to write a response", func(c *Config) *Duration { return &c.WriteTimeout }),
+	durationSetting("idle-timeout", "NGC4_IDLE_TIMEOUT", "maximum time to keep an idle connection open", func(c *Config) *Duration { return &c.IdleTimeout }),
+	durationSetting("shutdown-timeout", "NGC4_SHUTDOWN_TIMEOUT", "how long in-flight requests may drain on SIGINT/SIGTERM", func(c *Config) *Duration { return &c.ShutdownTimeout }),
+	stringSetting("log-level", "NGC4_LOG_LEVEL", "log level: debug, info, warn or error", func(c *Config) *string { return &c.LogLevel }),
+	stringSetting("item-code-prefix", "NGC4_ITEM_CODE_PREFIX", "prefix of generated item codes", func(c *Config) *string { return &c.ItemCode.Prefix }),
+	intSetting("item-code-width", "NGC4_ITEM_CODE_WIDTH", "digits of the sequence number in generated item codes", func(c *Config) *int { return &c.ItemCode.Width }),
+	stringSetting("auth-algorithm", "NGC4_AUTH_ALGORITHM", "algorithm new tokens are signed with: HS256 or RS256", func(c *Config) *string { return &c.Auth.Algorithm }),
+	stringSetting("auth-hmac-key-file", "NGC4_AUTH_HMAC_KEY_FILE", "file holding the HS256 secret, at least 32 bytes", func(c *Config) *string { return &c.Auth.HMACKeyFile }),
+	stringSetting("auth-hmac-key", "NGC4_AUTH_HMAC_KEY", "the HS256 secret itself, for local development", func(c *Config) *string { return &c.Auth.HMACKey }),
+	stringSetting("auth-rsa-key-file", "NGC4_AUTH_RSA_KEY_FILE", "PEM file holding the RS256 private key", func(c *Config) *string { return &c.Auth.RSAKeyFile }),
+	stringSetting("auth-issuer", "NGC4_AUTH_ISSUER", "iss claim of issued tokens, which verification requires", func(c *Config) *string { return &c.Auth.Issuer }),
+	durationSetting("auth-token-ttl", "NGC4_AUTH_TOKEN_TTL", "lifetime of issued tokens", func(c *Config) *Duration { return &c.Auth.TokenTTL }),
+	stringSetting("auth-admin-password-hash", "NGC4_AUTH_ADMIN_PASSWORD_HASH", "bcrypt hash of the password of an extra user admin with the admin role", func(c *Config) *string { return &c.Auth.AdminPasswordHash }),
+	stringSetting("stock-alert-webhook", "NGC4_STOCK_ALERT_WEBHOOK", "http(s) URL that low stock alerts are POSTed to", func(c *Config) *string { return &c.StockAlertWebhook }),
+}
+
+// Load resolves the configuration from args (without the program name), the
+// environment and the file named by -config or NGC4_CONFIG. It returns the
+// arguments left after the flags.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, []string, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("ngc4", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFile := fs.String("config", "", "optional JSON or YAML config file (env NGC4_CONFIG)")
+	flagValues := map[string]string{}
+	for _, s := range settings {
+		s := s
+		fs.Func(s.flag, fmt.Sprintf("%s (env %s, default %q)", s.usage, s.env, s.get(&cfg)), func(v string) error {
+			flagValues[s.flag] = v
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(os.Stderr)
+			fmt.Fprintln(os.Stderr, "Usage: ngc4 [flags] [serve | migrate up|down [n]|status | seed file... | reconcile | hash-password]")
+			fs.PrintDefaults()
+		}
+		return cfg, nil, err
+	}
+
+	// The default database name depends on the storage, which any layer
+	// may change, so it is only filled in when no layer names one.
+	named := false
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("NGC4_CONFIG")
+	}
+	if path != "" {
+		var err error
+		if named, err = loadFile(path, &cfg); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.env); ok {
+			if err := s.set(&cfg, v); err != nil {
+				return cfg, nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flagValues[s.flag]; ok {
+			if err := s.set(&cfg, v); err != nil {
+				return cfg, nil, fmt.Errorf("-%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if _, ok := lookupEnv("NGC4_DB_NAME"); ok {
+		named = true
+	}
+	if _, ok := flagValues["db-name"]; ok {
+		named = true
+	}
+	if !named {
+		cfg.DB.Name = defaultDBName(cfg.Storage)
+	}
+
+	return cfg, fs.Args(), cfg.Validate()
+}
+
+// defaultDBName is the database, or file for sqlite, of storage when no
+// layer names one.
+func defaultDBName(storage string) string {
+	if storage == "sqlite" {
+		return "ngc4.db"
+	}
+	return "p2_ngc4"
+}
+
+// loadFile decodes the config file at path into cfg and reports whether it
+// sets db.name.
+func loadFile(path string, cfg *Config) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		// Go through JSON so both formats share the json tags and the
+		// Duration parsing.
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return false, fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return false, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return false, fmt.Errorf("%s: config file must be .json, .yaml or .yml", path)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var name struct {
+		DB struct {
+			Name *string `json:"name"`
+		} `json:"db"`
+	}
+	if err := json.Unmarshal(data, &name); err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	return name.DB.Name != nil, nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	switch c.Storage {
+	case "mysql", "postgres", "sqlite", "memory":
+	default:
+		errs = append(errs, fmt.Errorf("storage: unknown backend %q", c.Storage))
+	}
+	if c.Storage != "memory" && c.DB.DSN == "" && c.DB.Name == "" {
+		errs = append(errs, errors.New("db name: is required unless db dsn is set"))
+	}
+	if c.DB.Port < 0 || c.DB.Port > 65535 {
+		errs = append(errs, fmt.Errorf("db port: %d is out of range", c.DB.Port))
+	}
+	if c.DB.Pool.MaxOpenConns < 0 || c.DB.Pool.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("db pool: connection limits cannot be negative"))
+	}
+	if c.DB.Pool.ConnMaxLifetime < 0 || c.DB.Pool.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("db pool: connection lifetimes cannot be negative"))
+	}
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen address: %w", err))
+	}
+	timeouts := []struct {
+		name  string
+		value Duration
+	}{
+		{"read header timeout", c.ReadHeaderTimeout},
+		{"read timeout", c.ReadTimeout},
+		{"write timeout", c.WriteTimeout},
+		{"idle timeout", c.IdleTimeout},
+		{"shutdown timeout", c.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be positive, got %s", t.name, t.value))
+		}
+	}
+	if _, err := c.Level(); err != nil {
+		errs = append(errs, err)
+	}
+	// Item codes hold at most 50 characters.
+	if c.ItemCode.Width < 1 {
+		errs = append(errs, fmt.Errorf("item code width: must be positive, got %d", c.ItemCode.Width))
+	} else if len(c.ItemCode.Prefix)+c.ItemCode.Width > 50 {
+		errs = append(errs, fmt.Errorf("item code: prefix %q with %d digits is longer than 50 characters", c.ItemCode.Prefix, c.ItemCode.Width))
+	}
+	// The key files are only read by serve, which fails when they hold no
+	// usable key. An HS256 key can be left out for the commands that do not
+	// issue tokens.
+	switch c.Auth.Algorithm {
+	case "HS256":
+	case "RS256":
+		if c.Auth.RSAKeyFile == "" {
+			errs = append(errs, errors.New("auth rsa key file: is required for RS256"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth algorithm: must be HS256 or RS256, got %q", c.Auth.Algorithm))
+	}
+	if c.Auth.HMACKey != "" && c.Auth.HMACKeyFile != "" {
+		errs = append(errs, errors.New("auth hmac key: set either the key or the key file, not both"))
+	}
+	if key := strings.TrimSpace(c.Auth.HMACKey); key != "" && len(key) < 32 {
+		errs = append(errs, fmt.Errorf("auth hmac key: must be at least 32 bytes, got %d", len(key)))
+	}
+	if c.Auth.Issuer == "" {
+		errs = append(errs, errors.New("auth issuer: is required"))
+	}
+	if c.Auth.TokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("auth token ttl: must be positive, got %s", c.Auth.TokenTTL))
+	}
+	usernames := map[string]bool{}
+	for i, u := range c.Auth.Users {
+		switch {
+		case u.Username == "" || u.PasswordHash == "" || u.Role == "":
+			errs = append(errs, fmt.Errorf("auth user %d: username, password_hash and role are required", i+1))
+		case usernames[u.Username]:
+			errs = append(errs, fmt.Errorf("auth user %q: listed twice", u.Username))
+		}
+		usernames[u.Username] = true
+	}
+	if c.Auth.AdminPasswordHash != "" && usernames["admin"] {
+		errs = append(errs, errors.New(`auth admin password hash: user "admin" is already listed in auth users`))
+	}
+	if c.StockAlertWebhook != "" {
+		if u, err := url.Parse(c.StockAlertWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("stock alert webhook: must be an http or https URL, got %q", c.StockAlertWebhook))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Level returns LogLevel as a slog level.
+func (c Config) Level() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return level, fmt.Errorf("log level: unknown level %q", c.LogLevel)
+	}
+	return level, nil
+}
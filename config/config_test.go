@@ -0,0 +1,271 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"ngc4/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a lookupEnv for Load that only knows vars.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+// writeFile writes a config file named name into a temporary directory and
+// returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestPrecedence sets the same keys in more and more layers and checks that
+// the later layer wins: defaults, the file, the environment, then flags.
+func TestPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+listen_addr: "file:8080"
+log_level: warn
+db:
+  name: file_db
+auth:
+  token_ttl: 2h
+`)
+
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		listen string
+		level  string
+		dbName string
+		ttl    time.Duration
+	}{
+		{"defaults", nil, nil, "localhost:8080", "info", "p2_ngc4", time.Hour},
+		{"file", []string{"-config", file}, nil, "file:8080", "warn", "file_db", 2 * time.Hour},
+		{"file from env", nil, map[string]string{"NGC4_CONFIG": file}, "file:8080", "warn", "file_db", 2 * time.Hour},
+		{"env over file", []string{"-config", file},
+			map[string]string{"NGC4_LISTEN_ADDR": "env:8080", "NGC4_DB_NAME": "env_db", "NGC4_AUTH_TOKEN_TTL": "3h"},
+			"env:8080", "warn", "env_db", 3 * time.Hour},
+		{"flags over env", []string{"-config", file, "-listen", "flag:8080", "-db-name", "flag_db", "-log-level", "debug"},
+			map[string]string{"NGC4_LISTEN_ADDR": "env:8080", "NGC4_DB_NAME": "env_db", "NGC4_AUTH_TOKEN_TTL": "3h"},
+			"flag:8080", "debug", "flag_db", 3 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := config.Load(tt.args, env(tt.env))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []any{cfg.ListenAddr, cfg.LogLevel, cfg.DB.Name, time.Duration(cfg.Auth.TokenTTL)}
+			want := []any{tt.listen, tt.level, tt.dbName, tt.ttl}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("listen, level, db name, ttl = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestDefaultDBName checks that the default database follows the storage
+// chosen by any layer, and that only a name set to nothing is refused.
+func TestDefaultDBName(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"mysql", nil, nil, "p2_ngc4"},
+		{"sqlite from env", nil, map[string]string{"NGC4_STORAGE": "sqlite"}, "ngc4.db"},
+		{"sqlite from flag", []string{"-storage", "sqlite"}, nil, "ngc4.db"},
+		{"named", []string{"-storage", "sqlite", "-db-name", "test.db"}, nil, "test.db"},
+	}
+	for _, tt := range tests {
+		cfg, _, err := config.Load(tt.args, env(tt.env))
+		if err != nil || cfg.DB.Name != tt.want {
+			t.Errorf("%s: db name = %q, %v; want %q", tt.name, cfg.DB.Name, err, tt.want)
+		}
+	}
+
+	_, _, err := config.Load(nil, env(map[string]string{"NGC4_DB_NAME": ""}))
+	if err == nil || !strings.Contains(err.Error(), "db name: is required") {
+		t.Errorf("Load() with NGC4_DB_NAME empty = %v, want a db name error", err)
+	}
+	if _, _, err := config.Load([]string{"-db-name", "", "-db-dsn", "root@tcp(db:3306)/ngc4"}, env(nil)); err != nil {
+		t.Errorf("Load() with a DSN and no name = %v", err)
+	}
+}
+
+// TestLoadFile loads the same settings from YAML and JSON files.
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+storage: postgres
+db:
+  host: db.internal
+  port: 5433
+  pool:
+    conn_max_lifetime: 10m
+shutdown_timeout: 45s
+item_code:
+  prefix: ITEM
+  width: 5
+auth:
+  algorithm: HS256
+  hmac_key_file: /run/secrets/jwt.key
+  users:
+    - username: fury
+      password_hash: $2a$10$hash
+      role: admin
+`,
+		"config.json": `{
+  "storage": "postgres",
+  "db": {"host": "db.internal", "port": 5433, "pool": {"conn_max_lifetime": "10m"}},
+  "shutdown_timeout": "45s",
+  "item_code": {"prefix": "ITEM", "width": 5},
+  "auth": {
+    "algorithm": "HS256",
+    "hmac_key_file": "/run/secrets/jwt.key",
+    "users": [{"username": "fury", "password_hash": "$2a$10$hash", "role": "admin"}]
+  }
+}`,
+	}
+
+	want := config.Default()
+	want.Storage = "postgres"
+	want.DB.Host = "db.internal"
+	want.DB.Port = 5433
+	want.DB.Name = "p2_ngc4"
+	want.DB.Pool.ConnMaxLifetime = config.Duration(10 * time.Minute)
+	want.ShutdownTimeout = config.Duration(45 * time.Second)
+	want.ItemCode = config.ItemCode{Prefix: "ITEM", Width: 5}
+	want.Auth.HMACKeyFile = "/run/secrets/jwt.key"
+	want.Auth.Users = []config.User{{Username: "fury", PasswordHash: "$2a$10$hash", Role: "admin"}}
+
+	for name, content := range files {
+		cfg, _, err := config.Load([]string{"-config", writeFile(t, name, content)}, env(nil))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%s: Load() = %+v, want %+v", name, cfg, want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		// file, when set, is written as config.<ext> and passed as -config.
+		ext, file string
+		want      string
+	}{
+		{"unknown yaml key", nil, nil, "yaml", "listen_adr: \":8080\"\n", `unknown field "listen_adr"`},
+		{"unknown nested key", nil, nil, "yaml", "db:\n  hostname: db\n", `unknown field "hostname"`},
+		{"unknown json key", nil, nil, "json", `{"auth": {"ttl": "1h"}}`, `unknown field "ttl"`},
+		{"bad file duration", nil, nil, "yaml", "read_timeout: 10 seconds\n", `time: unknown unit " seconds"`},
+		{"number as duration", nil, nil, "json", `{"read_timeout": 10}`, `duration must be a string`},
+		{"unsupported extension", nil, nil, "toml", "storage = \"sqlite\"\n", "config file must be .json, .yaml or .yml"},
+		{"bad env duration", nil, map[string]string{"NGC4_WRITE_TIMEOUT": "soon"}, "", "", "NGC4_WRITE_TIMEOUT: time: invalid duration"},
+		{"bad flag duration", []string{"-idle-timeout", "2"}, nil, "", "", "-idle-timeout: time: missing unit"},
+		{"bad env number", nil, map[string]string{"NGC4_DB_PORT": "http"}, "", "", `NGC4_DB_PORT: not a number: "http"`},
+		{"unknown flag", []string{"-listen-addr", ":8080"}, nil, "", "", "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.ext != "" {
+				args = append([]string{"-config", writeFile(t, "config."+tt.ext, tt.file)}, args...)
+			}
+			_, _, err := config.Load(args, env(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := config.Load([]string{"-h"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Load(-h) = %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := config.Default()
+	valid.DB.Name = "p2_ngc4"
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate() of the defaults = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *config.Config)
+		want   []string
+	}{
+		{"missing db name", func(c *config.Config) { c.DB.Name = "" },
+			[]string{"db name: is required"}},
+		{"memory needs no db name", func(c *config.Config) { c.Storage = "memory"; c.DB.Name = "" }, nil},
+		{"unknown storage", func(c *config.Config) { c.Storage = "oracle" },
+			[]string{`storage: unknown backend "oracle"`}},
+		{"hs256 key too short", func(c *config.Config) { c.Auth.HMACKey = "  short secret\n" },
+			[]string{"auth hmac key: must be at least 32 bytes, got 12"}},
+		{"hs256 key and key file", func(c *config.Config) {
+			c.Auth.HMACKey = strings.Repeat("k", 32)
+			c.Auth.HMACKeyFile = "jwt.key"
+		}, []string{"auth hmac key: set either the key or the key file, not both"}},
+		{"rs256 without key file", func(c *config.Config) { c.Auth.Algorithm = "RS256" },
+			[]string{"auth rsa key file: is required for RS256"}},
+		{"rs256 with key file", func(c *config.Config) { c.Auth.Algorithm = "RS256"; c.Auth.RSAKeyFile = "jwt.pem" }, nil},
+		{"unknown algorithm", func(c *config.Config) { c.Auth.Algorithm = "ES256" },
+			[]string{`auth algorithm: must be HS256 or RS256, got "ES256"`}},
+		{"no issuer", func(c *config.Config) { c.Auth.Issuer = "" },
+			[]string{"auth issuer: is required"}},
+		{"duplicate user", func(c *config.Config) {
+			c.Auth.Users = []config.User{{Username: "fury", PasswordHash: "x", Role: "admin"}, {Username: "fury", PasswordHash: "y", Role: "analyst"}}
+		}, []string{`auth user "fury": listed twice`}},
+		{"every error at once", func(c *config.Config) {
+			c.DB.Port = 70000
+			c.ReadTimeout = 0
+			c.LogLevel = "verbose"
+			c.StockAlertWebhook = "ftp://alerts"
+		}, []string{"db port: 70000 is out of range", "read timeout: must be positive", `log level: unknown level "verbose"`,
+			`stock alert webhook: must be an http or https URL, got "ftp://alerts"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			err := c.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.want)
+			}
+			if lines := strings.Split(err.Error(), "\n"); len(lines) != len(tt.want) {
+				t.Errorf("Validate() = %q, want %d errors", lines, len(tt.want))
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want an error containing %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -2,18 +2,119 @@ package config
 
 import (
 	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
-func GetDB() (*sql.DB, error) {
-	db, err := sql.Open("mysql", "root:@tcp(127.0.0.1:3306)/p2_ngc4")
+// PoolConfig controls how many connections the shared pool keeps open.
+type PoolConfig struct {
+	MaxOpenConns    int      `json:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time"`
+}
+
+var DefaultPool = PoolConfig{
+	MaxOpenConns:    25,
+	MaxIdleConns:    25,
+	ConnMaxLifetime: Duration(5 * time.Minute),
+	ConnMaxIdleTime: Duration(time.Minute),
+}
+
+// DBConfig selects the database/sql driver and the data source to open.
+// When DSN is empty it is built from the remaining fields, which fall back to
+// the defaults of the driver.
+type DBConfig struct {
+	Driver   string     `json:"-"`
+	DSN      string     `json:"dsn"`
+	Host     string     `json:"host"`
+	Port     int        `json:"port"`
+	User     string     `json:"user"`
+	Password string     `json:"password"`
+	Name     string     `json:"name"`
+	Pool     PoolConfig `json:"pool"`
+}
+
+// DataSource returns the DSN handed to sql.Open.
+func (c DBConfig) DataSource() string {
+	if c.DSN != "" {
+		return c.DSN
+	}
+
+	host := c.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	switch c.Driver {
+	case "sqlite3":
+		name := c.Name
+		if name == "" {
+			name = defaultDBName("sqlite")
+		}
+		// Transactions take the write lock when they begin. A deferred one
+		// that reads and then writes fails with "database is locked" when
+		// another writer got in between, instead of waiting its turn.
+		return "file:" + name + "?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+	case "postgres":
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(or(c.User, "postgres"), c.Password),
+			Host:     net.JoinHostPort(host, strconv.Itoa(orInt(c.Port, 5432))),
+			Path:     "/" + or(c.Name, defaultDBName("postgres")),
+			RawQuery: "sslmode=disable",
+		}
+		if c.Password == "" {
+			u.User = url.User(or(c.User, "postgres"))
+		}
+		return u.String()
+	default:
+		return fmt.Sprintf("%s:%s@tcp(%s)/%s", or(c.User, "root"), c.Password,
+			net.JoinHostPort(host, strconv.Itoa(orInt(c.Port, 3306))), or(c.Name, defaultDBName("mysql")))
+	}
+}
+
+func or(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func orInt(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+func GetDB(cfg DBConfig) (*sql.DB, error) {
+	switch cfg.Driver {
+	case "mysql", "sqlite3", "postgres":
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+
+	db, err := sql.Open(cfg.Driver, cfg.DataSource())
 
 	if err != nil {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(cfg.Pool.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Pool.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.Pool.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Duration(cfg.Pool.ConnMaxIdleTime))
+
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 	return db, nil
@@ -2,8 +2,17 @@ package entity
 
 type CrimeEvent struct {
 	ID          int
-	HeroID      int
-	VillainID   int
-	Description string
-	DateTime    string
+	Version     int
+	HeroID      int    `validate:"required,min=1"`
+	VillainID   int    `validate:"required,min=1"`
+	Description string `validate:"max=65535"`
+	DateTime    string `validate:"required,datetime"`
+}
+
+// CrimeEventDetail is a crime event with the hero and villain it refers to
+// embedded. Either of them is left out when it was not asked for.
+type CrimeEventDetail struct {
+	CrimeEvent
+	Hero    *Heroes  `json:",omitempty"`
+	Villain *Villain `json:",omitempty"`
 }
@@ -2,8 +2,9 @@ package entity
 
 type Heroes struct {
 	ID       int
-	Name     string
-	Universe string
-	Skill    string
-	ImageURL string
+	Version  int
+	Name     string `validate:"required,max=255"`
+	Universe string `validate:"required,max=255"`
+	Skill    string `validate:"max=255"`
+	ImageURL string `validate:"max=255"`
 }
@@ -1,10 +1,67 @@
 package entity
 
+// The states of an Item. Items go from Active to Broken, into repair and back
+// to Active, and can be Retired from any state but Retired itself.
+const (
+	ItemActive   = "Active"
+	ItemBroken   = "Broken"
+	ItemInRepair = "InRepair"
+	ItemRetired  = "Retired"
+)
+
+var itemTransitions = map[string][]string{
+	ItemActive:   {ItemBroken, ItemRetired},
+	ItemBroken:   {ItemInRepair, ItemRetired},
+	ItemInRepair: {ItemActive, ItemRetired},
+}
+
+// ItemCanTransition reports whether an item in status from may move to
+// status to.
+func ItemCanTransition(from, to string) bool {
+	for _, next := range itemTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
 type Item struct {
-	ID          int
-	Name        string
-	ItemCode    string
-	Stock       int
-	Description string
-	Status      string
+	ID      int
+	Version int
+	Name    string `validate:"required,max=255"`
+	// ItemCode is unique. The store generates one when it is left empty
+	// on create.
+	ItemCode string `validate:"max=50"`
+	Stock    int    `validate:"min=0"`
+	// ReorderThreshold is the stock below which the item needs
+	// reordering; zero turns the alert off.
+	ReorderThreshold int    `validate:"min=0"`
+	Description      string `validate:"max=255"`
+	Status           string `validate:"required,oneof=Active Broken InRepair Retired"`
+}
+
+// Movement is one entry of the stock ledger of an item: a change of Delta
+// that left the item with Stock. Movements are only ever appended, so the
+// Deltas of an item add up to its current Stock.
+type Movement struct {
+	ID        int
+	ItemID    int
+	Delta     int
+	Stock     int
+	Reason    string
+	Actor     string
+	CreatedAt string
+}
+
+// StatusChange is one entry of the status history of an item. FromStatus is
+// empty for the status an item was created with.
+type StatusChange struct {
+	ID         int
+	ItemID     int
+	FromStatus string
+	ToStatus   string
+	Reason     string
+	Actor      string
+	ChangedAt  string
 }
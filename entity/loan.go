@@ -0,0 +1,22 @@
+package entity
+
+// The states of a Loan. A loan is Out until it is returned, either in
+// working order or Broken.
+const (
+	LoanOut      = "Out"
+	LoanReturned = "Returned"
+	LoanBroken   = "Broken"
+)
+
+// Loan is Quantity units of an item checked out to a hero. ReturnedAt is nil
+// while the loan is Out. Times are UTC.
+type Loan struct {
+	ID           int
+	ItemID       int `validate:"required,min=1"`
+	HeroID       int `validate:"required,min=1"`
+	Quantity     int `validate:"required,min=1"`
+	Status       string
+	CheckedOutAt string
+	DueAt        string `validate:"required,datetime"`
+	ReturnedAt   *string
+}
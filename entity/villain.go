@@ -2,7 +2,8 @@ package entity
 
 type Villain struct {
 	ID       int
-	Name     string
-	Universe string
-	ImageURL string
+	Version  int
+	Name     string `validate:"required,max=255"`
+	Universe string `validate:"required,max=255"`
+	ImageURL string `validate:"max=255"`
 }
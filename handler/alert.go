@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"ngc4/entity"
+	"sync"
+	"time"
+)
+
+// LowStockAlert reports an item whose stock has just dropped below its
+// reorder threshold.
+type LowStockAlert struct {
+	Item entity.Item `json:"item"`
+	// PreviousStock is the stock before the change that crossed the
+	// threshold.
+	PreviousStock int    `json:"previous_stock"`
+	RequestID     string `json:"request_id"`
+}
+
+// Alerter delivers low stock alerts. LowStock is called after the change is
+// stored and must not block the request for long.
+type Alerter interface {
+	LowStock(ctx context.Context, alert LowStockAlert)
+}
+
+// Alerters sends every alert to each of its alerters in turn.
+type Alerters []Alerter
+
+func (as Alerters) LowStock(ctx context.Context, alert LowStockAlert) {
+	for _, a := range as {
+		a.LowStock(ctx, alert)
+	}
+}
+
+// LogAlerter writes alerts to the log at warn level.
+type LogAlerter struct{}
+
+func (LogAlerter) LowStock(ctx context.Context, alert LowStockAlert) {
+	slog.Warn("stock below reorder threshold", "request_id", alert.RequestID, "item", alert.Item.ID,
+		"item_code", alert.Item.ItemCode, "stock", alert.Item.Stock, "previous_stock", alert.PreviousStock,
+		"reorder_threshold", alert.Item.ReorderThreshold)
+}
+
+// webhookQueueSize is how many alerts a WebhookAlerter holds while its
+// endpoint is slow.
+const webhookQueueSize = 100
+
+// WebhookAlerter POSTs each alert as JSON to URL. Alerts wait in a bounded
+// queue for a single sender, so a slow endpoint delays them rather than piling
+// up goroutines; an alert arriving at a full queue is dropped. Delivery is not
+// retried and failures are logged. Create it with NewWebhookAlerter and stop
+// it with Close.
+type WebhookAlerter struct {
+	URL    string
+	Client *http.Client
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan webhookAlert
+	done   chan struct{}
+}
+
+type webhookAlert struct {
+	requestID string
+	body      []byte
+}
+
+func NewWebhookAlerter(url string) *WebhookAlerter {
+	a := &WebhookAlerter{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan webhookAlert, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go a.send()
+	return a
+}
+
+func (a *WebhookAlerter) LowStock(ctx context.Context, alert LowStockAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		slog.Error("stock alert webhook failed", "request_id", alert.RequestID, "error", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		slog.Error("stock alert webhook closed, dropping alert", "request_id", alert.RequestID, "url", a.URL)
+		return
+	}
+	select {
+	case a.queue <- webhookAlert{requestID: alert.RequestID, body: body}:
+	default:
+		slog.Error("stock alert webhook queue full, dropping alert", "request_id", alert.RequestID, "url", a.URL)
+	}
+}
+
+// Close stops taking alerts and waits until the queued ones are sent or ctx
+// is done.
+func (a *WebhookAlerter) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d stock alerts not sent: %w", len(a.queue), ctx.Err())
+	}
+}
+
+func (a *WebhookAlerter) send() {
+	defer close(a.done)
+	for alert := range a.queue {
+		if err := a.post(alert.body); err != nil {
+			slog.Error("stock alert webhook failed", "request_id", alert.requestID, "url", a.URL, "error", err)
+		}
+	}
+}
+
+func (a *WebhookAlerter) post(body []byte) error {
+	resp, err := a.Client.Post(a.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// checkReorder raises an alert when a stock change took item from at or
+// above its reorder threshold to below it. before is the item as it was.
+func (h *Handler) checkReorder(r *http.Request, before, after entity.Item) {
+	if h.Alerts == nil || !lowStock(after) || lowStock(before) {
+		return
+	}
+	h.Alerts.LowStock(r.Context(), LowStockAlert{
+		Item:          after,
+		PreviousStock: before.Stock,
+		RequestID:     RequestIDFromContext(r.Context()),
+	})
+}
+
+func lowStock(item entity.Item) bool {
+	return item.Stock < item.ReorderThreshold
+}
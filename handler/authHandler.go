@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"ngc4/auth"
+	"ngc4/validate"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Credentials is the body of POST /avengers/login.
+type Credentials struct {
+	Username string `validate:"required,max=255"`
+	// Password is capped by Login at the 72 bytes bcrypt looks at; the max
+	// rule would count characters instead.
+	Password string `validate:"required"`
+}
+
+// maxPasswordBytes is how much of a password bcrypt compares. A longer one
+// would log in with any suffix after its first 72 bytes.
+const maxPasswordBytes = 72
+
+// Token is the response of a successful login. The token goes into the
+// Authorization header of later requests as "Bearer <access_token>".
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the token in seconds.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// Login exchanges a user name and password for a token.
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if h.Tokens == nil {
+		writeError(w, r, Internal(errors.New("no token keys configured")))
+		return
+	}
+
+	var creds Credentials
+	if err := decodeBody(r, &creds); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(creds.Password) > maxPasswordBytes {
+		writeError(w, r, Invalid(validate.FieldError{Field: "Password", Rule: "max", Message: "must be at most 72 bytes"}))
+		return
+	}
+
+	user, err := h.Users.Authenticate(creds.Username, creds.Password)
+	if err != nil {
+		writeError(w, r, Unauthorized(err.Error()))
+		return
+	}
+
+	token, expires, err := h.Tokens.Issue(user.Username, user.Role)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Token{AccessToken: token, TokenType: "Bearer", ExpiresIn: int(time.Until(expires).Seconds())})
+}
+
+// Authenticate wraps next so that it only runs for requests with a valid
+// bearer token. The claims of the token are in the request context; see
+// auth.ClaimsFrom.
+func (h *Handler) Authenticate(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if h.Tokens == nil {
+			writeError(w, r, Internal(errors.New("no token keys configured")))
+			return
+		}
+
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			writeError(w, r, Unauthorized("missing bearer token"))
+			return
+		}
+
+		claims, err := h.Tokens.Verify(token)
+		if err != nil {
+			e := Unauthorized("invalid or expired token")
+			e.Err = err
+			writeError(w, r, e)
+			return
+		}
+
+		next(w, r.WithContext(auth.WithClaims(r.Context(), claims)), p)
+	}
+}
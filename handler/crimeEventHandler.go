@@ -2,230 +2,275 @@ package handler
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
-	"ngc4/config"
 	"ngc4/entity"
-	"strconv"
+	"ngc4/repository"
+	"ngc4/validate"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-func GetCrimeEvent(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+// crimeEventQuery is what GET /avengers/crimeevent can filter and sort on,
+// e.g. ?hero_id=2&from=2023-12-14&to=2023-12-16. from and to take a date or a
+// DateTime and both ends are inclusive. ?include=hero,villain embeds the
+// referenced rows.
+var crimeEventQuery = querySpec{
+	filters: map[string]filterParam{
+		"hero_id":    {"HeroID", "=", integer},
+		"villain_id": {"VillainID", "=", integer},
+		"from":       {"DateTime", ">=", dayStart},
+		"to":         {"DateTime", "<=", dayEnd},
+	},
+	sorts:    map[string]string{"id": "ID", "datetime": "DateTime", "hero_id": "HeroID", "villain_id": "VillainID"},
+	fields:   map[string]string{"id": "ID", "version": "Version", "hero_id": "HeroID", "villain_id": "VillainID", "description": "Description", "datetime": "DateTime"},
+	includes: map[string]string{"hero": "Hero", "villain": "Villain"},
+}
+
+func (h *Handler) GetCrimeEvent(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	include, err := parseInclude(r, crimeEventQuery)
 	if err != nil {
-		log.Fatal("Failed connecting to Database")
+		writeError(w, r, err)
+		return
+	}
+
+	if include == nil {
+		writePage(w, r, crimeEventQuery, h.Store.CrimeEvents.List)
+		return
 	}
-	defer db.Close()
 
-	ctx := context.Background()
-	var crimeEvent []entity.CrimeEvent
+	writePage(w, r, crimeEventQuery, func(ctx context.Context, q repository.ListQuery) ([]entity.CrimeEventDetail, int, error) {
+		crimeEvent, total, err := h.Store.CrimeEvents.ListWithRelations(ctx, q)
+		for i := range crimeEvent {
+			crimeEvent[i] = withRelations(crimeEvent[i], include)
+		}
+		return crimeEvent, total, err
+	})
+}
 
-	query := `
-		SELECT ID, HeroID, VillainID, Description, DateTime FROM crimeevent
-	`
+func (h *Handler) GetCrimeEventByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
+
+	fields, err := parseFields(r, crimeEventQuery)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	include, err := parseInclude(r, crimeEventQuery)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	rows, err := db.QueryContext(ctx, query)
+	id, err := parseID(p, "Crime Event")
 	if err != nil {
-		panic(err)
+		writeError(w, r, err)
+		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		ce := entity.CrimeEvent{}
-		err := rows.Scan(&ce.ID, &ce.HeroID, &ce.VillainID, &ce.Description, &ce.DateTime)
+	if include == nil {
+		crimeEvent, err := h.Store.CrimeEvents.FindByID(ctx, id)
 		if err != nil {
-			panic(err)
+			writeError(w, r, err)
+			return
 		}
+		writeTagged(w, r, http.StatusOK, etag(crimeEvent.Version), project(crimeEvent, fields))
+		return
+	}
 
-		crimeEvent = append(crimeEvent, ce)
+	crimeEvent, err := h.Store.CrimeEvents.FindByIDWithRelations(ctx, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	crimeEvent = withRelations(crimeEvent, include)
+	writeTagged(w, r, http.StatusOK, detailETag(crimeEvent), project(crimeEvent, fields))
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(crimeEvent)
+// detailETag also covers the versions of the embedded hero and villain, so
+// the tag changes when either of them does. If-Match on writes takes the
+// plain tag of the crime event.
+func detailETag(crimeEvent entity.CrimeEventDetail) string {
+	versions := []int{crimeEvent.Version}
+	if crimeEvent.Hero != nil {
+		versions = append(versions, crimeEvent.Hero.Version)
+	}
+	if crimeEvent.Villain != nil {
+		versions = append(versions, crimeEvent.Villain.Version)
+	}
+	return etag(versions...)
 }
 
-func GetCrimeEventByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed connecting to Database")
+// withRelations drops the relations of crimeEvent that include does not name.
+func withRelations(crimeEvent entity.CrimeEventDetail, include map[string]bool) entity.CrimeEventDetail {
+	if !include["hero"] {
+		crimeEvent.Hero = nil
 	}
-	defer db.Close()
+	if !include["villain"] {
+		crimeEvent.Villain = nil
+	}
+	return crimeEvent
+}
 
-	ctx := context.Background()
+func (h *Handler) CreateCrimeEvent(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 	var crimeEvent entity.CrimeEvent
 
-	id := p.ByName("id")
+	if err := decodeBody(r, &crimeEvent); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	query := `
-		SELECT ID, HeroID, VillainID, Description, DateTime FROM crimeevent WHERE ID = ?
-	`
+	if err := h.checkReferences(ctx, crimeEvent); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	row := db.QueryRowContext(ctx, query, id)
-	err = row.Scan(&crimeEvent.ID, &crimeEvent.HeroID, &crimeEvent.VillainID, &crimeEvent.Description, &crimeEvent.DateTime)
+	// The ID is always generated by the store.
+	crimeEvent.ID = 0
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.NotFound(w, r)
-			return
-		}
-		panic(err)
+	if err := h.Store.CrimeEvents.Create(ctx, &crimeEvent); err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(crimeEvent)
+	writeTagged(w, r, http.StatusCreated, etag(crimeEvent.Version), crimeEvent)
 }
 
-func CreateCrimeEvent(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed connecting to Database")
-	}
-	defer db.Close()
+func (h *Handler) DeleteCrimeEventByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-	ctx := context.Background()
-	var crimeEvent entity.CrimeEvent
-
-	err = json.NewDecoder(r.Body).Decode(&crimeEvent)
+	crimeEventID, err := parseID(p, "Crime Event")
 	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadGateway)
+		writeError(w, r, err)
 		return
 	}
 
-	query := `
-		INSERT INTO crimeevent (HeroID, VillainID, Description, DateTime)
-		VALUES (?, ?, ?, ?)
-	`
-
-	result, err := db.ExecContext(ctx, query, crimeEvent.HeroID, crimeEvent.VillainID, crimeEvent.Description, crimeEvent.DateTime)
+	existingCrimeEvent, err := h.Store.CrimeEvents.FindByID(ctx, crimeEventID)
 	if err != nil {
-		http.Error(w, "Failed to create Crime Event", http.StatusBadGateway)
-		log.Println("Error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	id, _ := result.LastInsertId()
+	if err := checkIfMatch(r, existingCrimeEvent.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	crimeEvent.ID = int(id)
+	if err := h.Store.CrimeEvents.Delete(ctx, crimeEventID, existingCrimeEvent.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(crimeEvent)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func DeleteCrimeEventByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+func (h *Handler) UpdateCrimeEventByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
+
+	crimeEventID, err := parseID(p, "Crime Event")
 	if err != nil {
-		log.Fatal("Failed connecting to Database")
+		writeError(w, r, err)
+		return
 	}
-	defer db.Close()
-
-	ctx := context.Background()
 
-	id := p.ByName("id")
-	crimeEventID, err := strconv.Atoi(id)
+	existingCrimeEvent, err := h.Store.CrimeEvents.FindByID(ctx, crimeEventID)
 	if err != nil {
-		http.Error(w, "Invalid Crime Event ID", http.StatusBadGateway)
+		writeError(w, r, err)
 		return
 	}
 
-	existingCrimeEvent, err := GetCEByID(ctx, db, crimeEventID)
-	if err != nil {
-		http.Error(w, "Failed to retrieve existing Crime Event ID", http.StatusBadGateway)
+	if err := checkIfMatch(r, existingCrimeEvent.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var updatedCrimeEvent entity.CrimeEvent
+	if err := decodeBody(r, &updatedCrimeEvent); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	if existingCrimeEvent.ID == 0 {
-		http.NotFound(w, r)
+	if err := h.checkReferences(ctx, updatedCrimeEvent); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	err = DeleteCrime(ctx, db, crimeEventID)
-	if err != nil {
-		http.Error(w, "Failed to delete Crime Event", http.StatusBadGateway)
+	existingCrimeEvent.HeroID = updatedCrimeEvent.HeroID
+	existingCrimeEvent.VillainID = updatedCrimeEvent.VillainID
+	existingCrimeEvent.Description = updatedCrimeEvent.Description
+	existingCrimeEvent.DateTime = updatedCrimeEvent.DateTime
+
+	if err := h.Store.CrimeEvents.Update(ctx, existingCrimeEvent); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNoContent)
+	existingCrimeEvent.Version++
+	writeTagged(w, r, http.StatusOK, etag(existingCrimeEvent.Version), existingCrimeEvent)
 }
 
-func GetCEByID(ctx context.Context, db *sql.DB, id int) (entity.CrimeEvent, error) {
-	var crimeEvent entity.CrimeEvent
+// checkReferences reports HeroID and VillainID values that do not point at an
+// existing hero or villain as validation errors, before the database's
+// foreign keys would reject them.
+func (h *Handler) checkReferences(ctx context.Context, crimeEvent entity.CrimeEvent) error {
+	var details []validate.FieldError
 
-	query := `
-		SELECT ID, HeroID, VillainID, Description, DateTime FROM crimeevent
-		WHERE ID = ?
-	`
+	if _, err := h.Store.Heroes.FindByID(ctx, crimeEvent.HeroID); errors.Is(err, repository.ErrNotFound) {
+		details = append(details, validate.FieldError{Field: "HeroID", Rule: "exists", Message: "hero does not exist"})
+	} else if err != nil {
+		return err
+	}
 
-	row := db.QueryRowContext(ctx, query, id)
-	err := row.Scan(&crimeEvent.ID, &crimeEvent.HeroID, &crimeEvent.VillainID, &crimeEvent.Description, &crimeEvent.DateTime)
-	return crimeEvent, err
-}
+	if _, err := h.Store.Villains.FindByID(ctx, crimeEvent.VillainID); errors.Is(err, repository.ErrNotFound) {
+		details = append(details, validate.FieldError{Field: "VillainID", Rule: "exists", Message: "villain does not exist"})
+	} else if err != nil {
+		return err
+	}
 
-func DeleteCrime(ctx context.Context, db *sql.DB, id int) error {
-	query := `
-        DELETE FROM crimeevent
-        WHERE ID = ?
-    `
-	_, err := db.ExecContext(ctx, query, id)
-	return err
+	if len(details) > 0 {
+		return Invalid(details...)
+	}
+	return nil
 }
 
-func UpdateCrimeEventByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+// PatchCrimeEventByID applies the request's patch to a crime event.
+func (h *Handler) PatchCrimeEventByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
+
+	crimeEventID, err := parseID(p, "Crime Event")
 	if err != nil {
-		log.Fatal("Failed connecting to Database")
+		writeError(w, r, err)
+		return
 	}
-	defer db.Close()
-
-	ctx := context.Background()
 
-	id := p.ByName("id")
-	crimeEventID, err := strconv.Atoi(id)
+	existingCrimeEvent, err := h.Store.CrimeEvents.FindByID(ctx, crimeEventID)
 	if err != nil {
-		http.Error(w, "Invalid Crime Event ID", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	existingCrimeEvent, err := GetCEByID(ctx, db, crimeEventID)
-	if err != nil {
-		http.Error(w, "Failed to retrieve Crime Event", http.StatusInternalServerError)
-		log.Println("Error:", err)
+	if err := checkIfMatch(r, existingCrimeEvent.Version); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	var updatedCrimeEvent entity.CrimeEvent
-	err = json.NewDecoder(r.Body).Decode(&updatedCrimeEvent)
+	patchedCrimeEvent, err := applyPatch(w, r, existingCrimeEvent)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	existingCrimeEvent.HeroID = updatedCrimeEvent.HeroID
-	existingCrimeEvent.VillainID = updatedCrimeEvent.VillainID
-	existingCrimeEvent.Description = updatedCrimeEvent.Description
-	existingCrimeEvent.DateTime = updatedCrimeEvent.DateTime
-
-	err = updateCrimeE(ctx, db, existingCrimeEvent)
-	if err != nil {
-		http.Error(w, "Failed to Crime Event", http.StatusInternalServerError)
-		log.Println("Error:", err)
+	if err := h.checkReferences(ctx, patchedCrimeEvent); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(existingCrimeEvent)
-}
+	if err := h.Store.CrimeEvents.Update(ctx, patchedCrimeEvent); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-func updateCrimeE(ctx context.Context, db *sql.DB, crimeEvent entity.CrimeEvent) error {
-	query := `
-        UPDATE crimeevent
-        SET HeroID = ?, VillainID = ?, Description = ?, DateTime = ?
-        WHERE ID = ?
-    `
-	_, err := db.ExecContext(ctx, query, crimeEvent.HeroID, crimeEvent.VillainID, crimeEvent.Description, crimeEvent.DateTime, crimeEvent.ID)
-	return err
+	patchedCrimeEvent.Version++
+	writeTagged(w, r, http.StatusOK, etag(patchedCrimeEvent.Version), patchedCrimeEvent)
 }
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"ngc4/repository"
+	"ngc4/validate"
+)
+
+// Kind classifies an Error and decides its HTTP status.
+type Kind string
+
+// The status mapping is the same for every route:
+//
+//	bad_request             400  the request cannot be parsed: malformed JSON, non-numeric ID
+//	unauthorized            401  no valid bearer token, or a failed login
+//	forbidden               403  the role of the token may not call the route
+//	not_found               404  the addressed resource does not exist
+//	conflict                409  the change clashes with other data: duplicate key, row still referenced,
+//	                             a concurrent write, stock that would go below zero, a loan returned twice,
+//	                             an item status its current one does not lead to
+//	precondition_failed     412  If-Match does not name the current version of the resource
+//	unsupported_media_type  415  the body is in a format the route does not accept
+//	validation              422  the request parses but its values are not acceptable
+//	internal                500  anything else; details are logged, not returned
+const (
+	KindBadRequest           Kind = "bad_request"
+	KindUnauthorized         Kind = "unauthorized"
+	KindForbidden            Kind = "forbidden"
+	KindNotFound             Kind = "not_found"
+	KindConflict             Kind = "conflict"
+	KindPreconditionFailed   Kind = "precondition_failed"
+	KindUnsupportedMediaType Kind = "unsupported_media_type"
+	KindValidation           Kind = "validation"
+	KindInternal             Kind = "internal"
+)
+
+var kindStatus = map[Kind]int{
+	KindBadRequest:           http.StatusBadRequest,
+	KindUnauthorized:         http.StatusUnauthorized,
+	KindForbidden:            http.StatusForbidden,
+	KindNotFound:             http.StatusNotFound,
+	KindConflict:             http.StatusConflict,
+	KindPreconditionFailed:   http.StatusPreconditionFailed,
+	KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	KindValidation:           http.StatusUnprocessableEntity,
+	KindInternal:             http.StatusInternalServerError,
+}
+
+// Error is the error every handler reports. Message is shown to the client;
+// Err is the underlying cause and is only logged.
+type Error struct {
+	Kind    Kind
+	Message string
+	Details []validate.FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Kind, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func BadRequest(message string) *Error {
+	return &Error{Kind: KindBadRequest, Message: message}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Kind: KindUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Kind: KindForbidden, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+func Validation(message string) *Error {
+	return &Error{Kind: KindValidation, Message: message}
+}
+
+// Invalid reports per-field validation failures.
+func Invalid(details ...validate.FieldError) *Error {
+	return &Error{Kind: KindValidation, Message: "request failed validation", Details: details}
+}
+
+func Conflict(message string, err error) *Error {
+	return &Error{Kind: KindConflict, Message: message, Err: err}
+}
+
+func PreconditionFailed(message string) *Error {
+	return &Error{Kind: KindPreconditionFailed, Message: message}
+}
+
+func UnsupportedMediaType(message string) *Error {
+	return &Error{Kind: KindUnsupportedMediaType, Message: message}
+}
+
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Message: "internal server error", Err: err}
+}
+
+// ErrorBody is the JSON document sent for every error response.
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code      Kind                  `json:"code"`
+	Message   string                `json:"message"`
+	Details   []validate.FieldError `json:"details,omitempty"`
+	RequestID string                `json:"request_id"`
+}
+
+// asError turns any error into an *Error. Repository sentinels keep their
+// meaning; everything else is internal.
+func asError(err error) *Error {
+	var e *Error
+	var fields validate.Errors
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.As(err, &fields):
+		return Invalid(fields...)
+	case errors.Is(err, repository.ErrNotFound):
+		return &Error{Kind: KindNotFound, Message: "resource not found", Err: err}
+	case errors.Is(err, repository.ErrInvalid):
+		return &Error{Kind: KindValidation, Message: "request contains invalid values", Err: err}
+	case errors.Is(err, repository.ErrConstraint):
+		return Conflict("request conflicts with existing data", err)
+	case errors.Is(err, repository.ErrInsufficientStock), errors.Is(err, repository.ErrReturned), errors.Is(err, repository.ErrTransition),
+		errors.Is(err, repository.ErrUnavailable):
+		return Conflict(err.Error(), err)
+	case errors.Is(err, repository.ErrStale):
+		return Conflict("resource was modified by another request; reload it and retry", err)
+	default:
+		return Internal(err)
+	}
+}
+
+// writeError renders err as an ErrorBody. Internal errors are logged with the
+// request id so the client-facing id can be traced in the logs.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e := asError(err)
+	id := RequestIDFromContext(r.Context())
+
+	// A request that stated the version it expects gets 412 when the row
+	// moved on between its If-Match check and the write.
+	if errors.Is(err, repository.ErrStale) && r.Header.Get("If-Match") != "" {
+		e = PreconditionFailed("resource has been modified since the given ETag")
+	}
+
+	if e.Kind == KindInternal {
+		slog.Error("request failed", "request_id", id, "method", r.Method, "path", r.URL.Path, "error", e.Err)
+	} else if e.Err != nil {
+		slog.Debug("request rejected", "request_id", id, "error", e)
+	}
+
+	if e.Kind == KindUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ngc4"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(kindStatus[e.Kind])
+	json.NewEncoder(w).Encode(ErrorBody{Error: ErrorDetail{Code: e.Kind, Message: e.Message, Details: e.Details, RequestID: id}})
+}
+
+// Panic is installed as the router's PanicHandler so a bug in one handler
+// answers with a 500 instead of dropping the connection.
+func Panic(w http.ResponseWriter, r *http.Request, v any) {
+	writeError(w, r, Internal(fmt.Errorf("panic: %v", v)))
+}
+
+// NotFoundHandler and MethodNotAllowedHandler answer unknown routes in the
+// same JSON format as the handlers.
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, NotFound("no route for "+r.URL.Path))
+	})
+}
+
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(ErrorBody{Error: ErrorDetail{
+			Code:      "method_not_allowed",
+			Message:   r.Method + " is not allowed on " + r.URL.Path,
+			RequestID: RequestIDFromContext(r.Context()),
+		}})
+	})
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag is the entity tag of a resource: its Version, followed by the
+// versions of the relations embedded in the representation, if any.
+func etag(versions ...int) string {
+	parts := make([]string, len(versions))
+	for i, v := range versions {
+		parts[i] = strconv.Itoa(v)
+	}
+	return `"` + strings.Join(parts, ".") + `"`
+}
+
+// etagListMatches reports whether header, the value of If-Match or
+// If-None-Match, names tag. "*" names every tag. Weak comparison ignores W/
+// prefixes, as If-None-Match requires; If-Match compares strongly.
+func etagListMatches(header, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch fails with 412 Precondition Failed when the request carries
+// an If-Match header that does not name the current version of the resource.
+// Requests without one are let through.
+func checkIfMatch(r *http.Request, version int) error {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagListMatches(header, etag(version), false) {
+		return nil
+	}
+	return PreconditionFailed("resource has been modified since the given ETag; its current ETag is " + etag(version))
+}
+
+// writeTagged writes v with its ETag. A GET whose If-None-Match already names
+// the tag is answered 304 Not Modified without a body.
+func writeTagged(w http.ResponseWriter, r *http.Request, status int, tag string, v any) {
+	w.Header().Set("ETag", tag)
+
+	if r.Method == http.MethodGet {
+		if header := r.Header.Get("If-None-Match"); header != "" && etagListMatches(header, tag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	writeJSON(w, status, v)
+}
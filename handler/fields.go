@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parseFields reads ?fields=, a comma separated list of spec.fields names,
+// into the JSON keys a response keeps. Relations asked for with ?include= are
+// kept as well. It returns nil when every field is wanted.
+func parseFields(r *http.Request, spec querySpec) ([]string, error) {
+	include, err := parseInclude(r, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, nil
+	}
+
+	var keys []string
+	for _, name := range strings.Split(v, ",") {
+		key, ok := spec.fields[name]
+		if !ok {
+			return nil, BadRequest("Unknown field " + strconv.Quote(name) + "; fields: " + strings.Join(sortedKeys(spec.fields), ", "))
+		}
+		keys = append(keys, key)
+	}
+	for name := range include {
+		keys = append(keys, spec.includes[name])
+	}
+	return keys, nil
+}
+
+// parseInclude reads ?include=, a comma separated list of spec.includes
+// names, into the set of relations to embed.
+func parseInclude(r *http.Request, spec querySpec) (map[string]bool, error) {
+	v := r.URL.Query().Get("include")
+	if v == "" {
+		return nil, nil
+	}
+	if spec.includes == nil {
+		return nil, BadRequest("include is not supported for this resource")
+	}
+
+	include := map[string]bool{}
+	for _, name := range strings.Split(v, ",") {
+		if _, ok := spec.includes[name]; !ok {
+			return nil, BadRequest("Cannot include " + strconv.Quote(name) + "; relations: " + strings.Join(sortedKeys(spec.includes), ", "))
+		}
+		include[name] = true
+	}
+	return include, nil
+}
+
+// project returns v with only the given JSON keys, or v itself when keys is
+// nil.
+func project(v any, keys []string) any {
+	if keys == nil {
+		return v
+	}
+
+	// Entities always marshal to a JSON object.
+	raw, _ := json.Marshal(v)
+	var all map[string]json.RawMessage
+	json.Unmarshal(raw, &all)
+
+	fields := make(map[string]json.RawMessage, len(keys))
+	for _, key := range keys {
+		if value, ok := all[key]; ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
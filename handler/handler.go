@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"ngc4/auth"
+	"ngc4/repository"
+	"ngc4/validate"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Handler serves the /avengers routes. Storage is reached only through the
+// repositories in Store, so handlers do not depend on a particular backend.
+type Handler struct {
+	Store repository.Store
+	// Alerts is told about items that drop below their reorder threshold.
+	Alerts Alerter
+	// Tokens verifies the bearer tokens every route but login requires, and
+	// issues them to the Users that log in.
+	Tokens *auth.Tokens
+	Users  auth.Users
+}
+
+// NewHandler returns a handler that logs low stock alerts.
+func NewHandler(store repository.Store) *Handler {
+	return &Handler{Store: store, Alerts: LogAlerter{}}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// parseID reads the :id route parameter.
+func parseID(p httprouter.Params, what string) (int, error) {
+	id, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		return 0, BadRequest("Invalid " + what + " ID")
+	}
+	return id, nil
+}
+
+// decodeBody reads the JSON request body into v and checks it against the
+// validate tags of its type.
+func decodeBody(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return BadRequest("Invalid request body: " + err.Error())
+	}
+	return validate.Struct(v)
+}
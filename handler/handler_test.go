@@ -0,0 +1,1104 @@
+package handler_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"ngc4/auth"
+	"ngc4/entity"
+	"ngc4/handler"
+	"ngc4/repository"
+	"ngc4/seed"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newServer returns the API backed by a memory store holding the demo
+// fixtures: heroes, villains and crime events 1-5 and items 1-10.
+func newServer(t *testing.T) http.Handler {
+	t.Helper()
+	_, srv := newStore(t)
+	return srv
+}
+
+// newStore is newServer that also returns the store behind the API.
+// Requests without an Authorization header are sent as user admin.
+func newStore(t *testing.T) (repository.Store, http.Handler) {
+	t.Helper()
+	store, h := newHandler(t)
+	return store, asUser(t, handler.RequestID(handler.NewRouter(h)), "admin", "admin")
+}
+
+// newHandler returns the handler of newStore, which accepts the tokens of
+// bearer and knows the users of testUsers.
+func newHandler(t *testing.T) (repository.Store, *handler.Handler) {
+	t.Helper()
+
+	fixtures, err := seed.LoadFile("../seed/fixtures/demo.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := repository.NewMemoryStore(repository.DefaultItemCodes)
+	if _, err := seed.Apply(context.Background(), store, fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	h := handler.NewHandler(store)
+	h.Tokens = testTokens
+	h.Users = testUsers()
+	return store, h
+}
+
+var testTokens, _ = auth.NewTokens(auth.Options{
+	Algorithm: auth.HS256,
+	HMACKey:   []byte("a test key that is long enough for HS256"),
+	Issuer:    "ngc4",
+	TTL:       time.Hour,
+})
+
+// testUsers has user fury with password "shield". Hashing is slow, so it is
+// only done once.
+var testUsers = sync.OnceValue(func() auth.Users {
+	hash, err := auth.HashPassword("shield")
+	if err != nil {
+		panic(err)
+	}
+	users, err := auth.NewUsers([]auth.User{{Username: "fury", PasswordHash: hash, Role: auth.RoleAdmin}})
+	if err != nil {
+		panic(err)
+	}
+	return users
+})
+
+// bearer returns an Authorization header value for username with role.
+func bearer(t *testing.T, username, role string) string {
+	t.Helper()
+	token, _, err := testTokens.Issue(username, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+// asUser sends the requests that have no Authorization header as username
+// with role.
+func asUser(t *testing.T, next http.Handler, username, role string) http.Handler {
+	header := bearer(t, username, role)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", header)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestStatusCodes(t *testing.T) {
+	const (
+		hero       = `{"Name":"Thor","Universe":"Marvel","Skill":"Thunder","ImageURL":"thor.jpg"}`
+		villain    = `{"Name":"Loki","Universe":"Marvel","ImageURL":"loki.jpg"}`
+		crimeEvent = `{"HeroID":1,"VillainID":2,"Description":"Bank heist","DateTime":"2023-12-20 10:00:00"}`
+		item       = `{"Name":"Shield","ItemCode":"CODE011","Stock":3,"Description":"Vibranium","Status":"Active"}`
+	)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"list heroes", "GET", "/avengers/heroes", "", 200},
+		{"list heroes page", "GET", "/avengers/heroes?limit=2&offset=2", "", 200},
+		{"list heroes bad limit", "GET", "/avengers/heroes?limit=0", "", 400},
+		{"list heroes limit too large", "GET", "/avengers/heroes?limit=501", "", 400},
+		{"list heroes bad offset", "GET", "/avengers/heroes?offset=-1", "", 400},
+		{"list heroes bad cursor", "GET", "/avengers/heroes?cursor=***", "", 400},
+		{"list heroes cursor with offset", "GET", "/avengers/heroes?cursor=WzJd&offset=1", "", 400},
+		{"list heroes cursor of another sort", "GET", "/avengers/heroes?sort=name&cursor=WzJd", "", 400},
+		{"list heroes unknown filter", "GET", "/avengers/heroes?power=flight", "", 400},
+		{"list heroes unknown sort", "GET", "/avengers/heroes?sort=skill", "", 400},
+		{"list heroes include", "GET", "/avengers/heroes?include=villain", "", 400},
+		{"get hero unknown field", "GET", "/avengers/heroes/1?fields=power", "", 400},
+		{"get hero", "GET", "/avengers/heroes/1", "", 200},
+		{"get missing hero", "GET", "/avengers/heroes/99", "", 404},
+		{"get hero bad id", "GET", "/avengers/heroes/abc", "", 400},
+		{"create hero", "POST", "/avengers/heroes", hero, 201},
+		{"create hero bad json", "POST", "/avengers/heroes", `{"Name":`, 400},
+		{"create hero without name", "POST", "/avengers/heroes", `{"Universe":"Marvel"}`, 422},
+		{"update hero", "PUT", "/avengers/heroes/1", hero, 200},
+		{"update missing hero", "PUT", "/avengers/heroes/99", hero, 404},
+		{"update hero bad id", "PUT", "/avengers/heroes/abc", hero, 400},
+		{"update hero bad json", "PUT", "/avengers/heroes/1", `[]`, 400},
+		{"update hero without universe", "PUT", "/avengers/heroes/1", `{"Name":"Thor"}`, 422},
+		{"patch hero without patch type", "PATCH", "/avengers/heroes/1", `{"Skill":"Flight"}`, 415},
+		{"patch missing hero", "PATCH", "/avengers/heroes/99", `{}`, 404},
+		{"patch hero bad id", "PATCH", "/avengers/heroes/abc", `{}`, 400},
+		{"delete referenced hero", "DELETE", "/avengers/heroes/1", "", 409},
+		{"delete missing hero", "DELETE", "/avengers/heroes/99", "", 404},
+		{"delete hero bad id", "DELETE", "/avengers/heroes/abc", "", 400},
+
+		{"list villains", "GET", "/avengers/villain", "", 200},
+		{"get villain", "GET", "/avengers/villain/2", "", 200},
+		{"get missing villain", "GET", "/avengers/villain/99", "", 404},
+		{"get villain bad id", "GET", "/avengers/villain/abc", "", 400},
+		{"create villain", "POST", "/avengers/villain", villain, 201},
+		{"create villain bad json", "POST", "/avengers/villain", `nope`, 400},
+		{"create villain without name", "POST", "/avengers/villain", `{"Universe":"Marvel"}`, 422},
+		{"update villain", "PUT", "/avengers/villain/2", villain, 200},
+		{"update missing villain", "PUT", "/avengers/villain/99", villain, 404},
+		{"update villain bad id", "PUT", "/avengers/villain/abc", villain, 400},
+		{"update villain bad json", "PUT", "/avengers/villain/2", `{`, 400},
+		{"patch villain without patch type", "PATCH", "/avengers/villain/2", `{}`, 415},
+		{"patch missing villain", "PATCH", "/avengers/villain/99", `{}`, 404},
+		{"delete referenced villain", "DELETE", "/avengers/villain/2", "", 409},
+		{"delete missing villain", "DELETE", "/avengers/villain/99", "", 404},
+		{"delete villain bad id", "DELETE", "/avengers/villain/abc", "", 400},
+
+		{"list crime events", "GET", "/avengers/crimeevent", "", 200},
+		{"list crime events bad date", "GET", "/avengers/crimeevent?from=14-12-2023", "", 400},
+		{"list crime events unknown include", "GET", "/avengers/crimeevent?include=sidekick", "", 400},
+		{"list crime events unknown field", "GET", "/avengers/crimeevent?fields=id,weather", "", 400},
+		{"get crime event with relations", "GET", "/avengers/crimeevent/3?include=hero,villain", "", 200},
+		{"get missing crime event with relations", "GET", "/avengers/crimeevent/99?include=hero", "", 404},
+		{"get crime event", "GET", "/avengers/crimeevent/3", "", 200},
+		{"get missing crime event", "GET", "/avengers/crimeevent/99", "", 404},
+		{"get crime event bad id", "GET", "/avengers/crimeevent/abc", "", 400},
+		{"create crime event", "POST", "/avengers/crimeevent", crimeEvent, 201},
+		{"create crime event bad json", "POST", "/avengers/crimeevent", `{"HeroID":"one"}`, 400},
+		{"create crime event unknown hero", "POST", "/avengers/crimeevent", `{"HeroID":99,"VillainID":1,"DateTime":"2023-12-20 10:00:00"}`, 422},
+		{"create crime event bad datetime", "POST", "/avengers/crimeevent", `{"HeroID":1,"VillainID":1,"DateTime":"yesterday"}`, 422},
+		{"update crime event", "PUT", "/avengers/crimeevent/3", crimeEvent, 200},
+		{"update missing crime event", "PUT", "/avengers/crimeevent/99", crimeEvent, 404},
+		{"update crime event bad id", "PUT", "/avengers/crimeevent/abc", crimeEvent, 400},
+		{"update crime event bad json", "PUT", "/avengers/crimeevent/3", `{`, 400},
+		{"update crime event unknown villain", "PUT", "/avengers/crimeevent/3", `{"HeroID":1,"VillainID":99,"DateTime":"2023-12-20 10:00:00"}`, 422},
+		{"patch crime event without patch type", "PATCH", "/avengers/crimeevent/3", `{}`, 415},
+		{"patch missing crime event", "PATCH", "/avengers/crimeevent/99", `{}`, 404},
+		{"delete crime event", "DELETE", "/avengers/crimeevent/3", "", 204},
+		{"delete missing crime event", "DELETE", "/avengers/crimeevent/99", "", 404},
+		{"delete crime event bad id", "DELETE", "/avengers/crimeevent/abc", "", 400},
+
+		{"list inventory", "GET", "/avengers/inventory", "", 200},
+		{"list inventory past the end", "GET", "/avengers/inventory?offset=100", "", 200},
+		{"list inventory bad stock filter", "GET", "/avengers/inventory?stock_lt=few", "", 400},
+		{"get item", "GET", "/avengers/inventory/10", "", 200},
+		{"get missing item", "GET", "/avengers/inventory/99", "", 404},
+		{"get item bad id", "GET", "/avengers/inventory/abc", "", 400},
+		{"create item", "POST", "/avengers/inventory", item, 201},
+		{"create item bad json", "POST", "/avengers/inventory", `{"Stock":"many"}`, 400},
+		{"create item bad status", "POST", "/avengers/inventory", `{"Name":"Shield","ItemCode":"CODE011","Stock":3,"Status":"Lost"}`, 422},
+		{"create item negative stock", "POST", "/avengers/inventory", `{"Name":"Shield","ItemCode":"CODE011","Stock":-1,"Status":"Active"}`, 422},
+		{"create item ignores id", "POST", "/avengers/inventory", `{"ID":1,"Name":"Shield","ItemCode":"CODE011","Stock":3,"Status":"Active"}`, 201},
+		{"create item without code", "POST", "/avengers/inventory", `{"Name":"Shield","Stock":3,"Status":"Active"}`, 201},
+		{"create item duplicate code", "POST", "/avengers/inventory", `{"Name":"Shield","ItemCode":"CODE001","Stock":3,"Status":"Active"}`, 409},
+		{"get item by code", "GET", "/avengers/inventory/code/CODE010", "", 200},
+		{"get item by missing code", "GET", "/avengers/inventory/code/CODE099", "", 404},
+		{"get unknown item subresource", "GET", "/avengers/inventory/10/loans", "", 404},
+		{"update item", "PUT", "/avengers/inventory/9", item, 200},
+		{"update item status", "PUT", "/avengers/inventory/10", item, 422},
+		{"update missing item", "PUT", "/avengers/inventory/99", item, 404},
+		{"update item bad id", "PUT", "/avengers/inventory/abc", item, 400},
+		{"update item bad json", "PUT", "/avengers/inventory/10", `{`, 400},
+		{"update item duplicate code", "PUT", "/avengers/inventory/9", `{"Name":"Shield","ItemCode":"CODE001","Stock":3,"Status":"Active"}`, 409},
+		{"update item without code", "PUT", "/avengers/inventory/9", `{"Name":"Shield","Stock":3,"Status":"Active"}`, 422},
+		{"update item bad status", "PUT", "/avengers/inventory/10", `{"Name":"Shield","ItemCode":"CODE011","Stock":3,"Status":"Lost"}`, 422},
+		{"patch item without patch type", "PATCH", "/avengers/inventory/10", `{}`, 415},
+		{"break item", "POST", "/avengers/inventory/9/break", `{"Reason":"dropped"}`, 200},
+		{"repair active item", "POST", "/avengers/inventory/9/repair", `{"Reason":"service"}`, 409},
+		{"repair broken item", "POST", "/avengers/inventory/10/repair", `{"Reason":"service"}`, 200},
+		{"restore broken item", "POST", "/avengers/inventory/10/restore", `{"Reason":"fixed"}`, 409},
+		{"retire item", "POST", "/avengers/inventory/10/retire", `{"Reason":"obsolete"}`, 200},
+		{"transition without reason", "POST", "/avengers/inventory/10/retire", `{}`, 422},
+		{"transition missing item", "POST", "/avengers/inventory/99/break", `{"Reason":"dropped"}`, 404},
+		{"item status history", "GET", "/avengers/inventory/10/status-history?to_status=Broken", "", 200},
+		{"status history of missing item", "GET", "/avengers/inventory/99/status-history", "", 404},
+		{"patch missing item", "PATCH", "/avengers/inventory/99", `{}`, 404},
+		{"adjust item", "POST", "/avengers/inventory/10/adjust", `{"Delta":-5,"Reason":"issued to field team"}`, 200},
+		{"adjust item below zero", "POST", "/avengers/inventory/10/adjust", `{"Delta":-6,"Reason":"issued to field team"}`, 409},
+		{"adjust item without reason", "POST", "/avengers/inventory/10/adjust", `{"Delta":3}`, 422},
+		{"adjust item by zero", "POST", "/avengers/inventory/10/adjust", `{"Delta":0,"Reason":"count"}`, 422},
+		{"adjust missing item", "POST", "/avengers/inventory/99/adjust", `{"Delta":1,"Reason":"count"}`, 404},
+		{"adjust item bad id", "POST", "/avengers/inventory/abc/adjust", `{"Delta":1,"Reason":"count"}`, 400},
+		{"adjust item bad json", "POST", "/avengers/inventory/10/adjust", `{"Delta":"one"}`, 400},
+		{"low stock report", "GET", "/avengers/inventory/low-stock?status=Broken", "", 200},
+		{"low stock report unknown filter", "GET", "/avengers/inventory/low-stock?threshold=5", "", 400},
+		{"update item negative threshold", "PUT", "/avengers/inventory/9", `{"Name":"Shield","ItemCode":"CODE009","Stock":3,"ReorderThreshold":-1,"Status":"Active"}`, 422},
+		{"list item movements", "GET", "/avengers/inventory/10/movements?actor=system&sort=-id", "", 200},
+		{"list movements unknown filter", "GET", "/avengers/inventory/10/movements?delta=5", "", 400},
+		{"list movements of missing item", "GET", "/avengers/inventory/99/movements", "", 404},
+		{"list movements bad id", "GET", "/avengers/inventory/abc/movements", "", 400},
+
+		{"list loans", "GET", "/avengers/loans?hero_id=1&sort=-due_at", "", 200},
+		{"list overdue loans", "GET", "/avengers/loans/overdue", "", 200},
+		{"list loans unknown sort", "GET", "/avengers/loans?sort=quantity", "", 400},
+		{"checkout", "POST", "/avengers/loans", `{"ItemID":1,"HeroID":2,"Quantity":3,"DueAt":"2999-01-01 00:00:00"}`, 201},
+		{"checkout more than stock", "POST", "/avengers/loans", `{"ItemID":10,"HeroID":2,"Quantity":6,"DueAt":"2999-01-01 00:00:00"}`, 409},
+		{"checkout already due", "POST", "/avengers/loans", `{"ItemID":1,"HeroID":2,"Quantity":1,"DueAt":"2000-01-01 00:00:00"}`, 422},
+		{"checkout unknown item", "POST", "/avengers/loans", `{"ItemID":99,"HeroID":2,"Quantity":1,"DueAt":"2999-01-01 00:00:00"}`, 422},
+		{"checkout without quantity", "POST", "/avengers/loans", `{"ItemID":1,"HeroID":2,"DueAt":"2999-01-01 00:00:00"}`, 422},
+		{"checkout bad json", "POST", "/avengers/loans", `{"ItemID":`, 400},
+		{"return missing loan", "POST", "/avengers/loans/99/return", `{"Condition":"Good"}`, 404},
+		{"return loan bad id", "POST", "/avengers/loans/abc/return", `{"Condition":"Good"}`, 400},
+		{"return loan bad condition", "POST", "/avengers/loans/1/return", `{"Condition":"Lost"}`, 422},
+		{"hero equipment", "GET", "/avengers/heroes/1/equipment", "", 200},
+		{"missing hero equipment", "GET", "/avengers/heroes/99/equipment", "", 404},
+		{"delete item", "DELETE", "/avengers/inventory/10", "", 204},
+		{"delete missing item", "DELETE", "/avengers/inventory/99", "", 404},
+		{"delete item bad id", "DELETE", "/avengers/inventory/abc", "", 400},
+
+		{"unknown route", "GET", "/avengers/sidekicks", "", 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d; body: %s", tt.method, tt.path, rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code < 400 {
+				return
+			}
+
+			var body handler.ErrorBody
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("error response is not JSON: %v", err)
+			}
+			if body.Error.Code == "" || body.Error.Message == "" {
+				t.Errorf("error body missing code or message: %+v", body)
+			}
+			if body.Error.RequestID == "" || body.Error.RequestID != rec.Header().Get("X-Request-ID") {
+				t.Errorf("request_id %q does not match X-Request-ID %q", body.Error.RequestID, rec.Header().Get("X-Request-ID"))
+			}
+		})
+	}
+}
+
+func TestPatch(t *testing.T) {
+	const (
+		merge = handler.MergePatchType
+		ops   = handler.JSONPatchType
+	)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+		// wantBody lists substrings of the response body.
+		wantBody []string
+	}{
+		{"merge keeps other fields", "/avengers/heroes/1", merge, `{"Skill":"Flight"}`, 200,
+			[]string{`"Name":"Superman"`, `"Skill":"Flight"`, `"ImageURL":"superman.jpg"`}},
+		{"merge cannot move the row", "/avengers/heroes/1", merge, `{"ID":7}`, 200, []string{`"ID":1`}},
+		{"merge cannot set the version", "/avengers/villain/1", merge, `{"Version":40}`, 200, []string{`"Version":2`}},
+		{"merge with parameters", "/avengers/villain/2", merge + "; charset=utf-8", `{"Universe":"DC"}`, 200, []string{`"Universe":"DC"`}},
+		{"merge removes required field", "/avengers/heroes/1", merge, `{"Name":null}`, 422, []string{`"field":"Name"`}},
+		{"merge unknown field", "/avengers/heroes/1", merge, `{"Power":"x"}`, 422, nil},
+		{"merge wrong type", "/avengers/inventory/10", merge, `{"Stock":"many"}`, 422, nil},
+		{"merge negative stock", "/avengers/inventory/10", merge, `{"Stock":-1}`, 422, []string{`"field":"Stock"`}},
+		{"merge status", "/avengers/inventory/10", merge, `{"Status":"Active"}`, 422, []string{`"rule":"transition"`}},
+		{"merge unknown hero", "/avengers/crimeevent/3", merge, `{"HeroID":99}`, 422, []string{`"field":"HeroID"`}},
+		{"merge malformed", "/avengers/heroes/1", merge, `{"Skill":`, 400, nil},
+		{"json patch test and replace", "/avengers/inventory/10", ops,
+			`[{"op":"test","path":"/Stock","value":5},{"op":"replace","path":"/Stock","value":7}]`, 200,
+			[]string{`"Stock":7`, `"ItemCode":"CODE010"`}},
+		{"json patch copy", "/avengers/crimeevent/3", ops,
+			`[{"op":"copy","from":"/HeroID","path":"/VillainID"}]`, 200, []string{`"VillainID":3`}},
+		{"json patch failed test", "/avengers/inventory/10", ops,
+			`[{"op":"test","path":"/Stock","value":6},{"op":"replace","path":"/Stock","value":7}]`, 409, nil},
+		{"json patch missing path", "/avengers/heroes/1", ops, `[{"op":"remove","path":"/Power"}]`, 409, nil},
+		{"json patch not an array", "/avengers/heroes/1", ops, `{"op":"replace"}`, 400, nil},
+		{"json patch bad op", "/avengers/heroes/1", ops, `[{"op":"frobnicate","path":"/Name"}]`, 400, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			newServer(t).ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("PATCH %s = %d, want %d; body: %s", tt.path, rec.Code, tt.want, rec.Body)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("PATCH %s: body %s does not contain %s", tt.path, rec.Body, want)
+				}
+			}
+		})
+	}
+}
+
+// TestConditionalRequests runs its steps in order against one server, so
+// each step sees the versions left by the previous ones.
+func TestConditionalRequests(t *testing.T) {
+	const hero = `{"Name":"Superman","Universe":"DC","Skill":"Flight"}`
+
+	steps := []struct {
+		method, path, header, value, body string
+		want                              int
+		wantETag                          string
+	}{
+		{"GET", "/avengers/heroes/1", "", "", "", 200, `"1"`},
+		{"GET", "/avengers/heroes/1", "If-None-Match", `"1"`, "", 304, `"1"`},
+		{"GET", "/avengers/heroes/1", "If-None-Match", `W/"1", "7"`, "", 304, `"1"`},
+		{"GET", "/avengers/heroes/1", "If-None-Match", `"7"`, "", 200, `"1"`},
+		{"PUT", "/avengers/heroes/1", "If-Match", `"2"`, hero, 412, ""},
+		{"PUT", "/avengers/heroes/1", "If-Match", `"1"`, hero, 200, `"2"`},
+		{"PUT", "/avengers/heroes/1", "", "", hero, 200, `"3"`},
+		{"GET", "/avengers/heroes/1", "If-None-Match", `"1"`, "", 200, `"3"`},
+		{"PATCH", "/avengers/heroes/1", "If-Match", `"2"`, `{"Skill":"Heat vision"}`, 412, ""},
+		{"PATCH", "/avengers/heroes/1", "If-Match", `"3"`, `{"Skill":"Heat vision"}`, 200, `"4"`},
+		{"PATCH", "/avengers/heroes/1", "If-Match", "*", `{"Version":1}`, 200, `"5"`},
+		{"GET", "/avengers/crimeevent/1?include=hero,villain", "", "", "", 200, `"1.5.1"`},
+		{"DELETE", "/avengers/crimeevent/1", "If-Match", `"2"`, "", 412, ""},
+		{"DELETE", "/avengers/crimeevent/1", "If-Match", `"1"`, "", 204, ""},
+		{"POST", "/avengers/villain", "", "", `{"Name":"Loki","Universe":"Marvel"}`, 201, `"1"`},
+	}
+
+	srv := newServer(t)
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		req.Header.Set("Content-Type", handler.MergePatchType)
+		if step.header != "" {
+			req.Header.Set(step.header, step.value)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		if rec.Code != step.want {
+			t.Fatalf("%s %s %s: %s = %d, want %d; body: %s", step.method, step.path, step.header, step.value, rec.Code, step.want, rec.Body)
+		}
+		if got := rec.Header().Get("ETag"); got != step.wantETag {
+			t.Errorf("%s %s: ETag = %s, want %s", step.method, step.path, got, step.wantETag)
+		}
+		if step.want == 304 && rec.Body.Len() != 0 {
+			t.Errorf("%s %s: 304 with body %s", step.method, step.path, rec.Body)
+		}
+	}
+}
+
+// TestAdjustStockConcurrently takes one unit at a time from item 10, which
+// holds 5, in parallel: exactly five withdrawals may succeed.
+func TestAdjustStockConcurrently(t *testing.T) {
+	srv := newServer(t)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 20)
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest("POST", "/avengers/inventory/10/adjust", strings.NewReader(`{"Delta":-1,"Reason":"issued"}`)))
+			codes <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	count := map[int]int{}
+	for code := range codes {
+		count[code]++
+	}
+	if count[200] != 5 || count[409] != 15 {
+		t.Errorf("status counts = %v, want 5 x 200 and 15 x 409", count)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", "/avengers/inventory/10", nil))
+	if !strings.Contains(rec.Body.String(), `"Stock":0`) {
+		t.Errorf("item 10 after withdrawals: %s", rec.Body)
+	}
+}
+
+// TestMovements changes the stock of item 10 in every way there is and
+// checks the ledger it leaves behind.
+func TestMovements(t *testing.T) {
+	store, srv := newStore(t)
+
+	steps := []struct {
+		method, path, contentType, body string
+	}{
+		{"POST", "/avengers/inventory/10/adjust", "", `{"Delta":-2,"Reason":"issued"}`},
+		{"PUT", "/avengers/inventory/10", "", `{"Name":"Grappling Hook","ItemCode":"CODE010","Stock":10,"Status":"Broken"}`},
+		{"PUT", "/avengers/inventory/10", "", `{"Name":"Grappling Hook","ItemCode":"CODE010","Stock":10,"Description":"renamed only","Status":"Broken"}`},
+		{"PATCH", "/avengers/inventory/10", handler.MergePatchType, `{"Stock":4}`},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		req.Header.Set("Authorization", bearer(t, "quartermaster", "quartermaster"))
+		if step.contentType != "" {
+			req.Header.Set("Content-Type", step.contentType)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("%s %s = %d; body: %s", step.method, step.path, rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", "/avengers/inventory/10/movements", nil))
+	var page struct {
+		Items []struct {
+			Delta, Stock  int
+			Reason, Actor string
+		} `json:"items"`
+		Total int `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("movements: %v; body: %s", err, rec.Body)
+	}
+
+	want := []string{"5 5 created system", "-2 3 issued quartermaster", "7 10 updated quartermaster", "-6 4 updated quartermaster"}
+	var got []string
+	for _, m := range page.Items {
+		got = append(got, fmt.Sprint(m.Delta, " ", m.Stock, " ", m.Reason, " ", m.Actor))
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) || page.Total != len(want) {
+		t.Errorf("movements = %q (total %d), want %q", got, page.Total, want)
+	}
+
+	// Deleting the item keeps its ledger and closes it.
+	req := httptest.NewRequest("DELETE", "/avengers/inventory/10", nil)
+	req.Header.Set("Authorization", bearer(t, "quartermaster", "quartermaster"))
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != 204 {
+		t.Fatalf("DELETE /avengers/inventory/10 = %d; body: %s", rec.Code, rec.Body)
+	}
+	movements, total, err := store.Items.ListMovements(context.Background(), 10, repository.ListQuery{})
+	if err != nil || total != len(want)+1 {
+		t.Fatalf("movements after delete: total %d, %v; want %d", total, err, len(want)+1)
+	}
+	if last := movements[len(movements)-1]; last.Delta != -4 || last.Stock != 0 || last.Reason != repository.ReasonDeleted || last.Actor != "quartermaster" {
+		t.Errorf("last movement after delete = %+v", last)
+	}
+
+	discrepancies, err := store.Items.Reconcile(context.Background())
+	if err != nil || len(discrepancies) != 0 {
+		t.Errorf("Reconcile() = %v, %v; want no discrepancies", discrepancies, err)
+	}
+}
+
+// TestDeletedItemHistory reads the ledger and status history that outlive a
+// deleted item over HTTP.
+func TestDeletedItemHistory(t *testing.T) {
+	srv := newServer(t)
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("DELETE", "/avengers/inventory/10", nil))
+	if rec.Code != 204 {
+		t.Fatalf("DELETE /avengers/inventory/10 = %d; body: %s", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		path  string
+		want  int
+		total int
+		last  string
+	}{
+		{"/avengers/inventory/10", 404, 0, ""},
+		{"/avengers/inventory/10/movements", 200, 2, "deleted"},
+		{"/avengers/inventory/10/status-history", 200, 1, "created"},
+		{"/avengers/inventory/10/movements?reason=issued", 200, 0, ""},
+		{"/avengers/inventory/99/movements", 404, 0, ""},
+		{"/avengers/inventory/99/status-history", 404, 0, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d; body: %s", tt.path, rec.Code, tt.want, rec.Body)
+			continue
+		}
+		if tt.want != 200 {
+			continue
+		}
+
+		var page struct {
+			Items []struct{ Reason string } `json:"items"`
+			Total int                       `json:"total"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("GET %s: %v; body: %s", tt.path, err, rec.Body)
+		}
+		last := ""
+		if len(page.Items) > 0 {
+			last = page.Items[len(page.Items)-1].Reason
+		}
+		if page.Total != tt.total || len(page.Items) != tt.total || last != tt.last {
+			t.Errorf("GET %s = %+v, want %d rows ending with %q", tt.path, page, tt.total, tt.last)
+		}
+	}
+}
+
+// TestLoans checks items out to heroes and back in, one step after the
+// other against the same server.
+func TestLoans(t *testing.T) {
+	store, srv := newStore(t)
+
+	// An overdue loan cannot be made through the API, which wants DueAt in
+	// the future.
+	overdue := entity.Loan{ItemID: 3, HeroID: 4, Quantity: 1, DueAt: "2020-01-01 00:00:00"}
+	if _, err := store.Loans.Checkout(context.Background(), &overdue); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		method, path, body string
+		want               int
+		// wantBody lists substrings of the response body.
+		wantBody []string
+	}{
+		{"POST", "/avengers/loans", `{"ItemID":1,"HeroID":2,"Quantity":20,"DueAt":"2999-01-01 00:00:00"}`, 201,
+			[]string{`"ID":2`, `"Status":"Out"`, `"ReturnedAt":null`}},
+		{"GET", "/avengers/inventory/1", "", 200, []string{`"Stock":30`}},
+		{"POST", "/avengers/loans", `{"ItemID":7,"HeroID":2,"Quantity":5,"DueAt":"2999-01-01 00:00:00"}`, 201, []string{`"ID":3`}},
+		{"GET", "/avengers/heroes/2/equipment", "", 200, []string{`"total":2`, `"ItemID":1`, `"ItemID":7`}},
+		{"GET", "/avengers/loans/overdue", "", 200, []string{`"total":1`, `"HeroID":4`}},
+		{"DELETE", "/avengers/heroes/2", "", 409, nil},
+		{"DELETE", "/avengers/inventory/1", "", 409, nil},
+		{"POST", "/avengers/loans/2/return", `{"Condition":"Good"}`, 200, []string{`"Status":"Returned"`, `"ReturnedAt":"`}},
+		{"POST", "/avengers/loans/2/return", `{"Condition":"Good"}`, 409, nil},
+		{"GET", "/avengers/inventory/1", "", 200, []string{`"Stock":50`}},
+		{"POST", "/avengers/loans/3/return", `{"Condition":"Broken"}`, 200, []string{`"Status":"Broken"`}},
+		// Broken units stay out of stock without taking the good ones
+		// out of service.
+		{"GET", "/avengers/inventory/7", "", 200, []string{`"Stock":30`, `"Status":"Active"`}},
+		{"GET", "/avengers/inventory/7/movements?sort=-id&limit=1", "", 200,
+			[]string{`"Delta":0`, `"Stock":30`, `"Reason":"5 returned broken by hero 2 on loan 3"`}},
+		{"GET", "/avengers/inventory/7/status-history", "", 200, []string{`"total":1`}},
+		{"POST", "/avengers/loans", `{"ItemID":7,"HeroID":3,"Quantity":1,"DueAt":"2999-01-01 00:00:00"}`, 201, []string{`"ID":4`}},
+		{"POST", "/avengers/loans", `{"ItemID":2,"HeroID":3,"Quantity":1,"DueAt":"2999-01-01 00:00:00"}`, 409, []string{`item 2 is Broken`}},
+		{"GET", "/avengers/heroes/2/equipment", "", 200, []string{`"total":0`}},
+		{"GET", "/avengers/inventory/1/movements?sort=-id&limit=1", "", 200, []string{`"Reason":"returned by hero 2 on loan 2"`}},
+	}
+	for _, step := range steps {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(step.method, step.path, strings.NewReader(step.body)))
+
+		if rec.Code != step.want {
+			t.Fatalf("%s %s = %d, want %d; body: %s", step.method, step.path, rec.Code, step.want, rec.Body)
+		}
+		for _, want := range step.wantBody {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s %s: body %s does not contain %s", step.method, step.path, rec.Body, want)
+			}
+		}
+	}
+
+	discrepancies, err := store.Items.Reconcile(context.Background())
+	if err != nil || len(discrepancies) != 0 {
+		t.Errorf("Reconcile() = %v, %v; want no discrepancies", discrepancies, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	// signed signs claims with key, the way a forged or stale token would be.
+	signed := func(method jwt.SigningMethod, key any, claims jwt.Claims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+	expired := &auth.Claims{Role: "admin", RegisteredClaims: jwt.RegisteredClaims{
+		Issuer: "ngc4", Subject: "admin", ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}}
+	valid := &auth.Claims{Role: "admin", RegisteredClaims: jwt.RegisteredClaims{
+		Issuer: "ngc4", Subject: "admin", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+
+	tests := []struct {
+		name          string
+		method, path  string
+		authorization string
+		body          string
+		want          int
+	}{
+		{"login", "POST", "/avengers/login", "", `{"Username":"fury","Password":"shield"}`, 200},
+		{"login wrong password", "POST", "/avengers/login", "", `{"Username":"fury","Password":"hydra"}`, 401},
+		{"login unknown user", "POST", "/avengers/login", "", `{"Username":"coulson","Password":"shield"}`, 401},
+		{"login without password", "POST", "/avengers/login", "", `{"Username":"fury"}`, 422},
+		// 40 characters, but 80 bytes: bcrypt would only compare the first 72.
+		{"login with long password", "POST", "/avengers/login", "", `{"Username":"fury","Password":"` + strings.Repeat("é", 40) + `"}`, 422},
+		{"valid token", "GET", "/avengers/heroes", bearer(t, "fury", "admin"), "", 200},
+		{"lower case scheme", "GET", "/avengers/heroes", "bearer " + strings.TrimPrefix(bearer(t, "fury", "admin"), "Bearer "), "", 200},
+		{"no token", "GET", "/avengers/heroes", "", "", 401},
+		{"no token on write", "DELETE", "/avengers/heroes/1", "", "", 401},
+		{"basic auth", "GET", "/avengers/heroes", "Basic ZnVyeTpzaGllbGQ=", "", 401},
+		{"malformed token", "GET", "/avengers/heroes", "Bearer not.a.token", "", 401},
+		{"expired token", "GET", "/avengers/heroes", signed(jwt.SigningMethodHS256, []byte("a test key that is long enough for HS256"), expired), "", 401},
+		{"token of another key", "GET", "/avengers/heroes", signed(jwt.SigningMethodHS256, []byte("some other key that is long enough too"), valid), "", 401},
+		{"unsigned token", "GET", "/avengers/heroes", signed(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid), "", 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newHandler(t)
+			srv := handler.RequestID(handler.NewRouter(h))
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d; body: %s", tt.method, tt.path, rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code == 401 {
+				if !strings.Contains(rec.Body.String(), `"code":"unauthorized"`) || rec.Header().Get("WWW-Authenticate") == "" {
+					t.Errorf("401 without WWW-Authenticate or the standard error body: %s", rec.Body)
+				}
+			}
+		})
+	}
+}
+
+// TestAuthorization checks the policy of each role. Statuses other than 403
+// only show that the request got past authorization.
+func TestAuthorization(t *testing.T) {
+	const (
+		item       = `{"Name":"Shield","Stock":3,"Status":"Active"}`
+		crimeEvent = `{"HeroID":1,"VillainID":2,"Description":"Bank heist","DateTime":"2023-12-20 10:00:00"}`
+		loan       = `{"ItemID":1,"HeroID":2,"Quantity":1,"DueAt":"2999-01-01 00:00:00"}`
+	)
+
+	tests := []struct {
+		role, method, path, body string
+		want                     int
+	}{
+		{auth.RoleAnalyst, "GET", "/avengers/heroes", "", 200},
+		{auth.RoleAnalyst, "GET", "/avengers/inventory/code/CODE001", "", 200},
+		{auth.RoleAnalyst, "GET", "/avengers/loans/overdue", "", 200},
+		{auth.RoleAnalyst, "POST", "/avengers/crimeevent", crimeEvent, 403},
+		{auth.RoleAnalyst, "POST", "/avengers/inventory/1/adjust", `{"Delta":1,"Reason":"count"}`, 403},
+		{auth.RoleAnalyst, "DELETE", "/avengers/heroes/1", "", 403},
+
+		{auth.RoleFieldAgent, "GET", "/avengers/crimeevent/1", "", 200},
+		{auth.RoleFieldAgent, "POST", "/avengers/crimeevent", crimeEvent, 201},
+		{auth.RoleFieldAgent, "PUT", "/avengers/crimeevent/1", crimeEvent, 403},
+		{auth.RoleFieldAgent, "DELETE", "/avengers/crimeevent/1", "", 403},
+		{auth.RoleFieldAgent, "POST", "/avengers/inventory", item, 403},
+		{auth.RoleFieldAgent, "POST", "/avengers/loans", loan, 403},
+
+		{auth.RoleQuartermaster, "POST", "/avengers/inventory", item, 201},
+		{auth.RoleQuartermaster, "PUT", "/avengers/inventory/9", `{"Name":"Shield","ItemCode":"CODE009","Stock":3,"Status":"Active"}`, 200},
+		{auth.RoleQuartermaster, "POST", "/avengers/inventory/1/adjust", `{"Delta":1,"Reason":"count"}`, 200},
+		{auth.RoleQuartermaster, "POST", "/avengers/inventory/1/break", `{"Reason":"dropped"}`, 200},
+		{auth.RoleQuartermaster, "DELETE", "/avengers/inventory/10", "", 204},
+		{auth.RoleQuartermaster, "POST", "/avengers/loans", loan, 201},
+		{auth.RoleQuartermaster, "POST", "/avengers/crimeevent", crimeEvent, 403},
+		{auth.RoleQuartermaster, "PATCH", "/avengers/heroes/1", `{"Skill":"Flight"}`, 403},
+		{auth.RoleQuartermaster, "DELETE", "/avengers/villain/1", "", 403},
+
+		// Hero 5 and villain 5 are still referenced by crime event 5.
+		{auth.RoleAdmin, "DELETE", "/avengers/heroes/5", "", 409},
+		{auth.RoleAdmin, "DELETE", "/avengers/villain/5", "", 409},
+		{auth.RoleAdmin, "DELETE", "/avengers/crimeevent/5", "", 204},
+		{auth.RoleAdmin, "POST", "/avengers/heroes", `{"Name":"Thor","Universe":"Marvel","Skill":"Thunder","ImageURL":"thor.jpg"}`, 201},
+
+		{"intern", "GET", "/avengers/heroes", "", 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+" "+tt.method+" "+tt.path, func(t *testing.T) {
+			_, h := newHandler(t)
+			srv := asUser(t, handler.RequestID(handler.NewRouter(h)), "tester", tt.role)
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s as %s = %d, want %d; body: %s", tt.method, tt.path, tt.role, rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code == 403 && !strings.Contains(rec.Body.String(), `"code":"forbidden"`) {
+				t.Errorf("403 without the standard error body: %s", rec.Body)
+			}
+		})
+	}
+}
+
+// TestLoginRS256 logs in against a server signing with RS256 and uses the
+// token it gets.
+func TestLoginRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, h := newHandler(t)
+	h.Tokens, err = auth.NewTokens(auth.Options{Algorithm: auth.RS256, RSAKey: key, Issuer: "ngc4", TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := handler.RequestID(handler.NewRouter(h))
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("POST", "/avengers/login", strings.NewReader(`{"Username":"fury","Password":"shield"}`)))
+	var token handler.Token
+	if err := json.Unmarshal(rec.Body.Bytes(), &token); err != nil || token.TokenType != "Bearer" || token.ExpiresIn <= 0 {
+		t.Fatalf("login = %d, %s", rec.Code, rec.Body)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token.AccessToken, &auth.Claims{})
+	if err != nil || parsed.Method.Alg() != auth.RS256 {
+		t.Fatalf("token %s: %v", token.AccessToken, err)
+	}
+
+	for authorization, want := range map[string]int{
+		"Bearer " + token.AccessToken: 200,
+		// The server has no HMAC key, so HS256 tokens are not accepted.
+		bearer(t, "fury", "admin"): 401,
+	} {
+		req := httptest.NewRequest("GET", "/avengers/inventory/1", nil)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("GET with %.20s... = %d, want %d; body: %s", authorization, rec.Code, want, rec.Body)
+		}
+	}
+}
+
+// alertRecorder keeps the low stock alerts it is sent.
+type alertRecorder struct {
+	mu     sync.Mutex
+	alerts []handler.LowStockAlert
+}
+
+func (a *alertRecorder) LowStock(ctx context.Context, alert handler.LowStockAlert) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.alerts = append(a.alerts, alert)
+}
+
+// TestLowStock lowers item 5 (stock 10, threshold 8) step by step and checks
+// that only the step crossing the threshold raises an alert.
+func TestLowStock(t *testing.T) {
+	_, h := newHandler(t)
+	alerts := &alertRecorder{}
+	h.Alerts = alerts
+	srv := asUser(t, handler.RequestID(handler.NewRouter(h)), "admin", "admin")
+
+	steps := []struct {
+		method, path, body string
+		wantAlerts         int
+		// wantBody lists substrings of the response body.
+		wantBody []string
+	}{
+		{"GET", "/avengers/inventory/low-stock", "", 0, []string{`"total":1`, `"ItemCode":"CODE010"`}},
+		{"POST", "/avengers/inventory/5/adjust", `{"Delta":-2,"Reason":"issued"}`, 0, []string{`"Stock":8`}},
+		{"POST", "/avengers/loans", `{"ItemID":5,"HeroID":1,"Quantity":1,"DueAt":"2999-01-01 00:00:00"}`, 1, nil},
+		{"POST", "/avengers/inventory/5/adjust", `{"Delta":-1,"Reason":"issued"}`, 1, []string{`"Stock":6`}},
+		{"GET", "/avengers/inventory/low-stock?sort=id", "", 1, []string{`"total":2`, `"ItemCode":"CODE005"`}},
+		{"POST", "/avengers/inventory/5/adjust", `{"Delta":10,"Reason":"restocked"}`, 1, []string{`"Stock":16`}},
+		{"PUT", "/avengers/inventory/5", `{"Name":"Item 5","ItemCode":"CODE005","Stock":16,"ReorderThreshold":20,"Status":"Active"}`, 2, nil},
+	}
+	for _, step := range steps {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(step.method, step.path, strings.NewReader(step.body)))
+
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s = %d; body: %s", step.method, step.path, rec.Code, rec.Body)
+		}
+		for _, want := range step.wantBody {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s %s: body %s does not contain %s", step.method, step.path, rec.Body, want)
+			}
+		}
+		if len(alerts.alerts) != step.wantAlerts {
+			t.Fatalf("after %s %s: %d alerts, want %d", step.method, step.path, len(alerts.alerts), step.wantAlerts)
+		}
+	}
+
+	if a := alerts.alerts[0]; a.Item.ID != 5 || a.Item.Stock != 7 || a.PreviousStock != 8 || a.RequestID == "" {
+		t.Errorf("first alert = %+v, want item 5 going from 8 to 7", a)
+	}
+}
+
+func TestWebhookAlerter(t *testing.T) {
+	received := make(chan handler.LowStockAlert, 3)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert handler.LowStockAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Error(err)
+		}
+		received <- alert
+	}))
+	defer hook.Close()
+
+	webhook := handler.NewWebhookAlerter(hook.URL)
+	for _, id := range []string{"abc", "def", "ghi"} {
+		webhook.LowStock(context.Background(),
+			handler.LowStockAlert{Item: entity.Item{ID: 5, Stock: 7, ReorderThreshold: 8}, PreviousStock: 8, RequestID: id})
+	}
+
+	// Close sends what is queued before it returns.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := webhook.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	webhook.LowStock(context.Background(), handler.LowStockAlert{RequestID: "after close"})
+
+	close(received)
+	var ids []string
+	for alert := range received {
+		if alert.Item.ID != 5 || alert.PreviousStock != 8 {
+			t.Errorf("webhook got %+v", alert)
+		}
+		ids = append(ids, alert.RequestID)
+	}
+	if fmt.Sprint(ids) != "[abc def ghi]" {
+		t.Errorf("webhook got alerts %q, want abc, def and ghi", ids)
+	}
+}
+
+// TestStatusWorkflow takes item 1 through its whole lifecycle and checks the
+// history it leaves.
+func TestStatusWorkflow(t *testing.T) {
+	srv := newServer(t)
+
+	steps := []struct {
+		path, ifMatch string
+		want          int
+	}{
+		{"/avengers/inventory/1/restore", "", 409},
+		{"/avengers/inventory/1/break", `"2"`, 412},
+		{"/avengers/inventory/1/break", `"1"`, 200},
+		{"/avengers/inventory/1/repair", "", 200},
+		{"/avengers/inventory/1/repair", "", 409},
+		{"/avengers/inventory/1/restore", "", 200},
+		{"/avengers/inventory/1/retire", "", 200},
+		{"/avengers/inventory/1/restore", "", 409},
+		{"/avengers/inventory/1/retire", "", 409},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest("POST", step.path, strings.NewReader(`{"Reason":"workflow test"}`))
+		req.Header.Set("Authorization", bearer(t, "quartermaster", "quartermaster"))
+		if step.ifMatch != "" {
+			req.Header.Set("If-Match", step.ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != step.want {
+			t.Fatalf("POST %s = %d, want %d; body: %s", step.path, rec.Code, step.want, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", "/avengers/inventory/1/status-history", nil))
+	var page struct {
+		Items []struct {
+			FromStatus, ToStatus, Actor string
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("status history: %v; body: %s", err, rec.Body)
+	}
+
+	want := []string{"->Active system", "Active->Broken quartermaster", "Broken->InRepair quartermaster",
+		"InRepair->Active quartermaster", "Active->Retired quartermaster"}
+	var got []string
+	for _, c := range page.Items {
+		got = append(got, c.FromStatus+"->"+c.ToStatus+" "+c.Actor)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("status history = %q, want %q", got, want)
+	}
+}
+
+// racingItems is an item store in which another writer updates an item
+// right after every read of it.
+type racingItems struct {
+	repository.ItemRepository
+}
+
+func (r racingItems) FindByID(ctx context.Context, id int) (entity.Item, error) {
+	item, err := r.ItemRepository.FindByID(ctx, id)
+	if err != nil {
+		return item, err
+	}
+	updated := item
+	updated.Description = "changed concurrently"
+	return item, r.ItemRepository.Update(ctx, updated)
+}
+
+// TestStatusWorkflowRace checks that a transition does not override a change
+// made after the handler checked If-Match.
+func TestStatusWorkflowRace(t *testing.T) {
+	_, h := newHandler(t)
+	h.Store.Items = racingItems{h.Store.Items}
+	srv := asUser(t, handler.RequestID(handler.NewRouter(h)), "admin", "admin")
+
+	for ifMatch, want := range map[string]int{`"1"`: 412, "": 409} {
+		req := httptest.NewRequest("POST", "/avengers/inventory/1/break", strings.NewReader(`{"Reason":"race test"}`))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("POST /avengers/inventory/1/break with If-Match %q = %d, want %d; body: %s", ifMatch, rec.Code, want, rec.Body)
+		}
+	}
+}
+
+// TestItemCodes creates items without an ItemCode and looks them up by the
+// generated one.
+func TestItemCodes(t *testing.T) {
+	srv := newServer(t)
+
+	for _, want := range []string{"CODE011", "CODE012"} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest("POST", "/avengers/inventory",
+			strings.NewReader(`{"ID":3,"Name":"Shield","Stock":3,"Status":"Active"}`)))
+		var created entity.Item
+		if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+			t.Fatalf("create: %v; body: %s", err, rec.Body)
+		}
+		if created.ItemCode != want || created.ID == 3 {
+			t.Fatalf("created item %d with code %q, want a new ID and %q", created.ID, created.ItemCode, want)
+		}
+
+		rec = httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest("GET", "/avengers/inventory/code/"+want, nil))
+		var found entity.Item
+		if err := json.Unmarshal(rec.Body.Bytes(), &found); err != nil {
+			t.Fatalf("get by code: %v; body: %s", err, rec.Body)
+		}
+		if found.ID != created.ID || rec.Header().Get("ETag") != `"1"` {
+			t.Errorf("GET by code %s = item %d, ETag %s; want item %d, ETag \"1\"", want, found.ID, rec.Header().Get("ETag"), created.ID)
+		}
+	}
+}
+
+// TestFieldsAndInclude checks which JSON keys come back for ?fields= and
+// ?include=.
+func TestFieldsAndInclude(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/avengers/heroes/1?fields=id,name", []string{"ID", "Name"}},
+		{"/avengers/villain/1?fields=universe", []string{"Universe"}},
+		{"/avengers/inventory/1?fields=item_code,stock", []string{"ItemCode", "Stock"}},
+		{"/avengers/crimeevent/3", []string{"DateTime", "Description", "HeroID", "ID", "Version", "VillainID"}},
+		{"/avengers/crimeevent/3?include=hero", []string{"DateTime", "Description", "Hero", "HeroID", "ID", "Version", "VillainID"}},
+		{"/avengers/inventory/1?fields=id,version", []string{"ID", "Version"}},
+		{"/avengers/crimeevent/3?include=hero,villain&fields=id", []string{"Hero", "ID", "Villain"}},
+		{"/avengers/crimeevent?hero_id=3&include=villain&fields=description", []string{"Description", "Villain"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newServer(t).ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s = %d; body: %s", tt.path, rec.Code, rec.Body)
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			// List responses are checked on their first item.
+			if raw, ok := body["items"]; ok {
+				var items []map[string]json.RawMessage
+				if err := json.Unmarshal(raw, &items); err != nil || len(items) == 0 {
+					t.Fatalf("GET %s: no items in %s", tt.path, raw)
+				}
+				body = items[0]
+			}
+
+			var keys []string
+			for key := range body {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if fmt.Sprint(keys) != fmt.Sprint(tt.want) {
+				t.Errorf("GET %s: keys = %v, want %v", tt.path, keys, tt.want)
+			}
+			if hero, ok := body["Hero"]; ok && !strings.Contains(string(hero), "Wonder Woman") {
+				t.Errorf("GET %s: Hero = %s, want Wonder Woman", tt.path, hero)
+			}
+		})
+	}
+}
+
+// TestListQueries follows next_cursor through every page of each listing and
+// checks the IDs it collects, in order.
+func TestListQueries(t *testing.T) {
+	tests := []struct {
+		path  string
+		total int
+		want  []int
+	}{
+		{"/avengers/inventory?limit=4", 10, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"/avengers/inventory?limit=3&sort=-stock", 10, []int{1, 9, 4, 7, 2, 6, 3, 8, 5, 10}},
+		{"/avengers/inventory?limit=1&status=Broken&stock_lt=20", 2, []int{8, 10}},
+		{"/avengers/heroes?universe=Marvel&sort=-name", 3, []int{2, 4, 5}},
+		{"/avengers/heroes?limit=2&sort=universe,-id", 5, []int{3, 1, 5, 4, 2}},
+		{"/avengers/villain?universe=DC", 2, []int{1, 3}},
+		{"/avengers/crimeevent?hero_id=2&from=2023-12-14&to=2023-12-16", 1, []int{2}},
+		{"/avengers/crimeevent?limit=2&from=2023-12-14&to=2023-12-16", 3, []int{2, 3, 4}},
+		{"/avengers/crimeevent?to=2023-12-15%2012:00:00&sort=-datetime", 3, []int{3, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			srv := newServer(t)
+
+			var ids []int
+			path := tt.path
+			for pages := 0; path != ""; pages++ {
+				if pages == 20 {
+					t.Fatal("cursor never ran out")
+				}
+
+				rec := httptest.NewRecorder()
+				srv.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("GET %s = %d; body: %s", path, rec.Code, rec.Body)
+				}
+
+				var page handler.Page[struct{ ID int }]
+				if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+					t.Fatal(err)
+				}
+				if page.Total != tt.total {
+					t.Errorf("GET %s: total = %d, want %d", path, page.Total, tt.total)
+				}
+				for _, item := range page.Items {
+					ids = append(ids, item.ID)
+				}
+
+				path = ""
+				if page.NextCursor != nil {
+					path = tt.path + "&cursor=" + *page.NextCursor
+				}
+			}
+
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("IDs = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
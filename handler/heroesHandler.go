@@ -1,231 +1,172 @@
 package handler
 
 import (
-	"context"
-	"database/sql"
-	"encoding/json"
-	"log"
 	"net/http"
-	"ngc4/config"
 	"ngc4/entity"
-	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-func GetHeroes(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed connecting to Database")
-	}
-	defer db.Close()
+// heroQuery is what GET /avengers/heroes can filter and sort on, e.g.
+// ?universe=Marvel&sort=-name.
+var heroQuery = querySpec{
+	filters: map[string]filterParam{
+		"name":     {"Name", "=", text},
+		"universe": {"Universe", "=", text},
+		"skill":    {"Skill", "=", text},
+	},
+	sorts:  map[string]string{"id": "ID", "name": "Name", "universe": "Universe"},
+	fields: map[string]string{"id": "ID", "version": "Version", "name": "Name", "universe": "Universe", "skill": "Skill", "image_url": "ImageURL"},
+}
 
-	ctx := context.Background()
-	var hero []entity.Heroes
+func (h *Handler) GetHeroes(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writePage(w, r, heroQuery, h.Store.Heroes.List)
+}
 
-	query := `
-		SELECT ID, Name, Universe, Skill, ImageURL FROM heroes
-	`
+func (h *Handler) GetHeroesByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-	rows, err := db.QueryContext(ctx, query)
+	fields, err := parseFields(r, heroQuery)
 	if err != nil {
-		panic(err)
+		writeError(w, r, err)
+		return
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		h := entity.Heroes{}
-		err := rows.Scan(&h.ID, &h.Name, &h.Universe, &h.Skill, &h.ImageURL)
-		if err != nil {
-			panic(err)
-		}
 
-		hero = append(hero, h)
+	id, err := parseID(p, "Hero")
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(hero)
-}
-
-func GetHeroesByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+	hero, err := h.Store.Heroes.FindByID(ctx, id)
 	if err != nil {
-		log.Fatal("Failed connecting to Database")
+		writeError(w, r, err)
+		return
 	}
-	defer db.Close()
 
-	ctx := context.Background()
-	var hero entity.Heroes
+	writeTagged(w, r, http.StatusOK, etag(hero.Version), project(hero, fields))
+}
 
-	id := p.ByName("id")
+func (h *Handler) CreateHero(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
+	var hero entity.Heroes
 
-	query := `
-		SELECT ID, Name, Universe, Skill, ImageURL FROM heroes WHERE ID = ?
-	`
+	if err := decodeBody(r, &hero); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	row := db.QueryRowContext(ctx, query, id)
-	err = row.Scan(&hero.ID, &hero.Name, &hero.Universe, &hero.Skill, &hero.ImageURL)
+	// The ID is always generated by the store.
+	hero.ID = 0
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.NotFound(w, r)
-			return
-		}
-		panic(err)
+	if err := h.Store.Heroes.Create(ctx, &hero); err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(hero)
+	writeTagged(w, r, http.StatusCreated, etag(hero.Version), hero)
 }
 
-func CreateHero(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed connecting to Database")
-	}
-	defer db.Close()
-
-	ctx := context.Background()
-	var hero entity.Heroes
+func (h *Handler) DeleteHeroByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-	err = json.NewDecoder(r.Body).Decode(&hero)
+	HeroID, err := parseID(p, "Hero")
 	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadGateway)
+		writeError(w, r, err)
 		return
 	}
 
-	query := `
-		INSERT INTO heroes (Name, Universe, Skill, ImageURL)
-		VALUES (?, ?, ?, ?)
-	`
-
-	result, err := db.ExecContext(ctx, query, hero.Name, hero.Universe, hero.Skill, hero.ImageURL)
+	existingHero, err := h.Store.Heroes.FindByID(ctx, HeroID)
 	if err != nil {
-		http.Error(w, "Failed to create Hero", http.StatusBadGateway)
-		log.Println("Error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	id, _ := result.LastInsertId()
+	if err := checkIfMatch(r, existingHero.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	hero.ID = int(id)
+	if err := h.Store.Heroes.Delete(ctx, HeroID, existingHero.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(hero)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func DeleteHeroByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed connecting to Database")
-	}
-	defer db.Close()
+func (h *Handler) UpdateHeroByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-	ctx := context.Background()
-
-	id := p.ByName("id")
-	HeroID, err := strconv.Atoi(id)
+	HeroID, err := parseID(p, "Hero")
 	if err != nil {
-		http.Error(w, "Invalid Hero ID", http.StatusBadGateway)
+		writeError(w, r, err)
 		return
 	}
 
-	existingHero, err := GetHByID(ctx, db, HeroID)
+	existingHero, err := h.Store.Heroes.FindByID(ctx, HeroID)
 	if err != nil {
-		http.Error(w, "Failed to retrieve existing Hero ID", http.StatusBadGateway)
+		writeError(w, r, err)
 		return
 	}
 
-	if existingHero.ID == 0 {
-		http.NotFound(w, r)
+	if err := checkIfMatch(r, existingHero.Version); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	err = DeleteHero(ctx, db, HeroID)
-	if err != nil {
-		http.Error(w, "Failed to delete Hero", http.StatusBadGateway)
+	var updatedHero entity.Heroes
+	if err := decodeBody(r, &updatedHero); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNoContent)
-}
-
-func GetHByID(ctx context.Context, db *sql.DB, id int) (entity.Heroes, error) {
-	var hero entity.Heroes
+	existingHero.Name = updatedHero.Name
+	existingHero.Universe = updatedHero.Universe
+	existingHero.Skill = updatedHero.Skill
+	existingHero.ImageURL = updatedHero.ImageURL
 
-	query := `
-		SELECT ID, Name, Universe, Skill, ImageURL FROM heroes
-		WHERE ID = ?
-	`
+	if err := h.Store.Heroes.Update(ctx, existingHero); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	row := db.QueryRowContext(ctx, query, id)
-	err := row.Scan(&hero.ID, &hero.Name, &hero.Universe, &hero.Skill, &hero.ImageURL)
-	return hero, err
+	existingHero.Version++
+	writeTagged(w, r, http.StatusOK, etag(existingHero.Version), existingHero)
 }
 
-func DeleteHero(ctx context.Context, db *sql.DB, id int) error {
-	query := `
-        DELETE FROM heroes
-        WHERE ID = ?
-    `
-	_, err := db.ExecContext(ctx, query, id)
-	return err
-}
+// PatchHeroByID applies the request's patch to a hero.
+func (h *Handler) PatchHeroByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-func UpdateHeroByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+	heroID, err := parseID(p, "Hero")
 	if err != nil {
-		log.Fatal("Failed connecting to Database")
+		writeError(w, r, err)
+		return
 	}
-	defer db.Close()
-
-	ctx := context.Background()
 
-	id := p.ByName("id")
-	HeroID, err := strconv.Atoi(id)
+	existingHero, err := h.Store.Heroes.FindByID(ctx, heroID)
 	if err != nil {
-		http.Error(w, "Invalid Hero ID", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	existingHero, err := GetHByID(ctx, db, HeroID)
-	if err != nil {
-		http.Error(w, "Failed to retrieve hero", http.StatusInternalServerError)
-		log.Println("Error:", err)
+	if err := checkIfMatch(r, existingHero.Version); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	var updatedHero entity.Heroes
-	err = json.NewDecoder(r.Body).Decode(&updatedHero)
+	patchedHero, err := applyPatch(w, r, existingHero)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	existingHero.Name = updatedHero.Name
-	existingHero.Universe = updatedHero.Universe
-	existingHero.Skill = updatedHero.Skill
-	existingHero.ImageURL = updatedHero.ImageURL
-
-	err = updateHero(ctx, db, existingHero)
-	if err != nil {
-		http.Error(w, "Failed to Crime Event", http.StatusInternalServerError)
-		log.Println("Error:", err)
+	if err := h.Store.Heroes.Update(ctx, patchedHero); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(existingHero)
-}
-
-func updateHero(ctx context.Context, db *sql.DB, hero entity.Heroes) error {
-	query := `
-        UPDATE heroes
-        SET Name = ?, Universe = ?, Skill = ?, ImageURL = ?
-        WHERE ID = ?
-    `
-	_, err := db.ExecContext(ctx, query, hero.Name, hero.Universe, hero.Skill, hero.ImageURL, hero.ID)
-	return err
+	patchedHero.Version++
+	writeTagged(w, r, http.StatusOK, etag(patchedHero.Version), patchedHero)
 }
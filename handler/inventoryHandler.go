@@ -2,223 +2,443 @@ package handler
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
-	"ngc4/config"
+	"ngc4/auth"
 	"ngc4/entity"
-	"strconv"
+	"ngc4/repository"
+	"ngc4/validate"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-func GetInventory(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed to connect")
+// itemQuery is what GET /avengers/inventory can filter and sort on, e.g.
+// ?status=Broken&stock_lt=20.
+var itemQuery = querySpec{
+	filters: map[string]filterParam{
+		"name":      {"Name", "=", text},
+		"item_code": {"ItemCode", "=", text},
+		"status":    {"Status", "=", text},
+		"stock_lt":  {"Stock", "<", integer},
+		"stock_lte": {"Stock", "<=", integer},
+		"stock_gt":  {"Stock", ">", integer},
+		"stock_gte": {"Stock", ">=", integer},
+	},
+	sorts: map[string]string{"id": "ID", "name": "Name", "item_code": "ItemCode", "stock": "Stock",
+		"reorder_threshold": "ReorderThreshold", "status": "Status"},
+	fields: map[string]string{"id": "ID", "version": "Version", "name": "Name", "item_code": "ItemCode", "stock": "Stock",
+		"reorder_threshold": "ReorderThreshold", "description": "Description", "status": "Status"},
+}
+
+// movementQuery is what GET /avengers/inventory/:id/movements can filter and
+// sort on, e.g. ?actor=stark&sort=-id.
+var movementQuery = querySpec{
+	filters: map[string]filterParam{
+		"actor":  {"Actor", "=", text},
+		"reason": {"Reason", "=", text},
+	},
+	sorts:  map[string]string{"id": "ID"},
+	fields: map[string]string{"id": "ID", "item_id": "ItemID", "delta": "Delta", "stock": "Stock", "reason": "Reason", "actor": "Actor", "created_at": "CreatedAt"},
+}
+
+// statusHistoryQuery is what GET /avengers/inventory/:id/status-history can
+// filter and sort on, e.g. ?to_status=Broken.
+var statusHistoryQuery = querySpec{
+	filters: map[string]filterParam{
+		"from_status": {"FromStatus", "=", text},
+		"to_status":   {"ToStatus", "=", text},
+		"actor":       {"Actor", "=", text},
+	},
+	sorts: map[string]string{"id": "ID"},
+	fields: map[string]string{"id": "ID", "item_id": "ItemID", "from_status": "FromStatus", "to_status": "ToStatus",
+		"reason": "Reason", "actor": "Actor", "changed_at": "ChangedAt"},
+}
+
+// stockContext attributes the stock movements a request writes to the user
+// its token was issued to.
+func stockContext(r *http.Request) context.Context {
+	actor := "anonymous"
+	if claims, ok := auth.ClaimsFrom(r.Context()); ok {
+		actor = claims.Subject
 	}
-	defer db.Close()
+	return repository.WithActor(r.Context(), actor)
+}
 
-	ctx := context.Background()
-	var item []entity.Item
+func (h *Handler) GetInventory(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writePage(w, r, itemQuery, h.Store.Items.List)
+}
 
-	query := `SELECT ID, Name, ItemCode, Stock, Description, Status FROM item`
+// GetInventoryByID also serves GET /avengers/inventory/low-stock, which
+// httprouter cannot register next to /:id.
+func (h *Handler) GetInventoryByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		panic(err)
+	if p.ByName("id") == "low-stock" {
+		h.GetLowStockInventory(w, r, p)
+		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		i := entity.Item{}
-		err := rows.Scan(&i.ID, &i.Name, &i.ItemCode, &i.Stock, &i.Description, &i.Status)
-		if err != nil {
-			panic(err)
-		}
-		item = append(item, i)
+	fields, err := parseFields(r, itemQuery)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(item)
-}
+	id, err := parseID(p, "item")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-func GetInventoryByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+	item, err := h.Store.Items.FindByID(ctx, id)
 	if err != nil {
-		log.Fatal("Failed to connect")
+		writeError(w, r, err)
+		return
 	}
-	defer db.Close()
 
-	ctx := context.Background()
-	var item entity.Item
+	writeTagged(w, r, http.StatusOK, etag(item.Version), project(item, fields))
+}
 
-	id := p.ByName("id")
+// GetLowStockInventory lists the items whose stock is below their reorder
+// threshold. It takes the same query parameters as GET /avengers/inventory,
+// e.g. ?status=Active&sort=stock.
+func (h *Handler) GetLowStockInventory(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writePage(w, r, itemQuery, func(ctx context.Context, q repository.ListQuery) ([]entity.Item, int, error) {
+		q.Filters = append(q.Filters, repository.Filter{Column: "Stock", Op: "<", Value: repository.Ref("ReorderThreshold")})
+		return h.Store.Items.List(ctx, q)
+	})
+}
 
-	query := `SELECT ID, Name, ItemCode, Stock, Description, Status FROM item WHERE ID = ?`
+// GetInventoryByCode looks an item up by its ItemCode, as in
+// GET /avengers/inventory/code/CODE011.
+func (h *Handler) GetInventoryByCode(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-	row := db.QueryRowContext(ctx, query, id)
-	err = row.Scan(&item.ID, &item.Name, &item.ItemCode, &item.Stock, &item.Description, &item.Status)
+	fields, err := parseFields(r, itemQuery)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
+	item, err := h.Store.Items.FindByCode(ctx, p.ByName("code"))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.NotFound(w, r)
-			return
-		}
-		panic(err)
+		writeError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(item)
+	writeTagged(w, r, http.StatusOK, etag(item.Version), project(item, fields))
 }
 
-func CreateInventory(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed to connect")
+// GetInventorySubresource serves GET /avengers/inventory/:id/:sub. httprouter
+// cannot route the static /code/:code next to /:id, so the lookup by code and
+// the per-item listings share this one route.
+func (h *Handler) GetInventorySubresource(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if p.ByName("id") == "code" {
+		h.GetInventoryByCode(w, r, httprouter.Params{{Key: "code", Value: p.ByName("sub")}})
+		return
+	}
+
+	switch p.ByName("sub") {
+	case "movements":
+		h.GetInventoryMovements(w, r, p)
+	case "status-history":
+		h.GetInventoryStatusHistory(w, r, p)
+	default:
+		NotFoundHandler().ServeHTTP(w, r)
 	}
-	defer db.Close()
+}
 
-	ctx := context.Background()
+// CreateInventory stores a new item. An omitted ItemCode is generated; a
+// duplicate one is refused with 409.
+func (h *Handler) CreateInventory(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := stockContext(r)
 
 	var newItem entity.Item
-	err = json.NewDecoder(r.Body).Decode(&newItem)
-	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if err := decodeBody(r, &newItem); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	query := `
-        INSERT INTO item (ID, Name, ItemCode, Stock, Description, Status)
-        VALUES (?, ?, ?, ?, ?, ?)
-    `
+	// The ID is always generated by the store.
+	newItem.ID = 0
 
-	_, err = db.ExecContext(ctx, query, newItem.ID, newItem.Name, newItem.ItemCode, newItem.Stock, newItem.Description, newItem.Status)
-	if err != nil {
-		http.Error(w, "Failed to create inventory item", http.StatusBadRequest)
-		log.Println("Error", err)
+	if err := h.Store.Items.Create(ctx, &newItem); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(newItem)
+	writeTagged(w, r, http.StatusCreated, etag(newItem.Version), newItem)
 }
 
-func UpdateInventoryID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+func (h *Handler) UpdateInventoryID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := stockContext(r)
+
+	itemID, err := parseID(p, "item")
 	if err != nil {
-		log.Fatal("Failed to connect")
+		writeError(w, r, err)
+		return
 	}
-	defer db.Close()
-
-	ctx := context.Background()
 
-	id := p.ByName("id")
-	itemID, err := strconv.Atoi(id)
+	existingItem, err := h.Store.Items.FindByID(ctx, itemID)
 	if err != nil {
-		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	existingItem, err := getItemByID(ctx, db, itemID)
-	if err != nil {
-		http.Error(w, "Failed to retrieve existing inventory item", http.StatusInternalServerError)
-		log.Println("Error:", err)
+	if err := checkIfMatch(r, existingItem.Version); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	var updatedItem entity.Item
-	err = json.NewDecoder(r.Body).Decode(&updatedItem)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeBody(r, &updatedItem); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
+	if err := checkItemUpdate(existingItem, updatedItem); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	before := existingItem
 	existingItem.Name = updatedItem.Name
 	existingItem.ItemCode = updatedItem.ItemCode
 	existingItem.Stock = updatedItem.Stock
+	existingItem.ReorderThreshold = updatedItem.ReorderThreshold
 	existingItem.Description = updatedItem.Description
 	existingItem.Status = updatedItem.Status
 
-	err = updateItem(ctx, db, existingItem)
-	if err != nil {
-		http.Error(w, "Failed to update inventory item", http.StatusInternalServerError)
-		log.Println("Error:", err)
+	if err := h.Store.Items.Update(ctx, existingItem); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(existingItem)
+	existingItem.Version++
+	h.checkReorder(r, before, existingItem)
+	writeTagged(w, r, http.StatusOK, etag(existingItem.Version), existingItem)
 }
 
-func getItemByID(ctx context.Context, db *sql.DB, id int) (entity.Item, error) {
-	var item entity.Item
-	query := `
-        SELECT ID, Name, ItemCode, Stock, Description, Status
-        FROM item
-        WHERE ID = ?
-    `
-	row := db.QueryRowContext(ctx, query, id)
-	err := row.Scan(&item.ID, &item.Name, &item.ItemCode, &item.Stock, &item.Description, &item.Status)
-	return item, err
-}
+func (h *Handler) DeleteInventoryByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := stockContext(r)
+
+	itemID, err := parseID(p, "item")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	existingItem, err := h.Store.Items.FindByID(ctx, itemID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := checkIfMatch(r, existingItem.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-func updateItem(ctx context.Context, db *sql.DB, item entity.Item) error {
-	query := `
-        UPDATE item
-        SET Name = ?, ItemCode = ?, Stock = ?, Description = ?, Status = ?
-        WHERE ID = ?
-    `
-	_, err := db.ExecContext(ctx, query, item.Name, item.ItemCode, item.Stock, item.Description, item.Status, item.ID)
-	return err
+	if err := h.Store.Items.Delete(ctx, itemID, existingItem.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func DeleteInventoryByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+// PatchInventoryByID applies the request's patch to an item.
+func (h *Handler) PatchInventoryByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := stockContext(r)
+
+	itemID, err := parseID(p, "item")
 	if err != nil {
-		log.Fatal("Failed to connect")
+		writeError(w, r, err)
+		return
 	}
-	defer db.Close()
 
-	ctx := context.Background()
+	existingItem, err := h.Store.Items.FindByID(ctx, itemID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := checkIfMatch(r, existingItem.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	id := p.ByName("id")
-	itemID, err := strconv.Atoi(id)
+	patchedItem, err := applyPatch(w, r, existingItem)
 	if err != nil {
-		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+
+	if err := checkItemUpdate(existingItem, patchedItem); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.Store.Items.Update(ctx, patchedItem); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	existingItem, err := getItemByID(ctx, db, itemID)
+	patchedItem.Version++
+	h.checkReorder(r, existingItem, patchedItem)
+	writeTagged(w, r, http.StatusOK, etag(patchedItem.Version), patchedItem)
+}
+
+// StockAdjustment is the body of POST /avengers/inventory/:id/adjust.
+type StockAdjustment struct {
+	// Delta is added to Stock; negative values take items out.
+	Delta  int    `validate:"required"`
+	Reason string `validate:"required,max=255"`
+}
+
+// AdjustInventoryByID changes the stock of an item by a signed delta without
+// a read-modify-write round trip, and responds with the updated item. An
+// adjustment that would leave the stock below zero is refused with 409.
+func (h *Handler) AdjustInventoryByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := stockContext(r)
+
+	itemID, err := parseID(p, "item")
 	if err != nil {
-		http.Error(w, "Failed to retrieve existing inventory item", http.StatusBadRequest)
-		log.Println("Error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	if existingItem.ID == 0 {
-		http.NotFound(w, r)
+	var adjustment StockAdjustment
+	if err := decodeBody(r, &adjustment); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	err = deleteItem(ctx, db, itemID)
+	item, err := h.Store.Items.AdjustStock(ctx, itemID, adjustment.Delta, adjustment.Reason)
 	if err != nil {
-		http.Error(w, "Failed to delete inventory item", http.StatusBadRequest)
-		log.Println("Error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNoContent)
+	slog.Info("stock adjusted", "request_id", RequestIDFromContext(r.Context()), "item", itemID,
+		"delta", adjustment.Delta, "reason", adjustment.Reason, "stock", item.Stock)
+
+	before := item
+	before.Stock -= adjustment.Delta
+	h.checkReorder(r, before, item)
+
+	writeTagged(w, r, http.StatusOK, etag(item.Version), item)
+}
+
+// GetInventoryMovements lists the stock ledger of an item, oldest first. The
+// ledger of a deleted item can still be read.
+func (h *Handler) GetInventoryMovements(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	itemID, err := parseID(p, "item")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writePage(w, r, movementQuery, itemHistory(h.Store.Items, itemID, func(ctx context.Context, q repository.ListQuery) ([]entity.Movement, int, error) {
+		return h.Store.Items.ListMovements(ctx, itemID, q)
+	}))
 }
 
-func deleteItem(ctx context.Context, db *sql.DB, id int) error {
-	query := `
-        DELETE FROM item
-        WHERE ID = ?
-    `
-	_, err := db.ExecContext(ctx, query, id)
-	return err
+// itemHistory wraps list, which reads the history of item id, so that it
+// fails with repository.ErrNotFound when the item does not exist and has no
+// history at all. The history outlives the item, so a deleted item still has
+// one; only the filters of q can leave it empty.
+func itemHistory[T any](items repository.ItemRepository, id int,
+	list func(context.Context, repository.ListQuery) ([]T, int, error)) func(context.Context, repository.ListQuery) ([]T, int, error) {
+	return func(ctx context.Context, q repository.ListQuery) ([]T, int, error) {
+		rows, total, err := list(ctx, q)
+		if err != nil || total > 0 {
+			return rows, total, err
+		}
+		if _, all, err := list(ctx, repository.ListQuery{Limit: 1}); err != nil || all > 0 {
+			return rows, total, err
+		}
+		if _, err := items.FindByID(ctx, id); err != nil {
+			return nil, 0, err
+		}
+		return rows, total, nil
+	}
+}
+
+// checkItemUpdate refuses a PUT or PATCH that clears ItemCode, which only a
+// create may leave to the store, or that changes Status, which only moves
+// through the transition routes.
+func checkItemUpdate(existing, updated entity.Item) error {
+	var details []validate.FieldError
+	if updated.ItemCode == "" {
+		details = append(details, validate.FieldError{Field: "ItemCode", Rule: "required", Message: "is required"})
+	}
+	if updated.Status != existing.Status {
+		details = append(details, validate.FieldError{Field: "Status", Rule: "transition",
+			Message: "status changes through POST /avengers/inventory/:id/break, repair, restore or retire"})
+	}
+	if len(details) > 0 {
+		return Invalid(details...)
+	}
+	return nil
+}
+
+// StatusTransition is the body of the item status transition routes.
+type StatusTransition struct {
+	Reason string `validate:"required,max=255"`
+}
+
+// TransitionInventory returns the handler of a route that moves an item to
+// status to, e.g. POST /avengers/inventory/:id/repair. A transition the
+// current status does not allow is refused with 409, and so is one racing
+// another change of the item, with 412 if the request has If-Match.
+func (h *Handler) TransitionInventory(to string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := stockContext(r)
+
+		itemID, err := parseID(p, "item")
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		existingItem, err := h.Store.Items.FindByID(ctx, itemID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if err := checkIfMatch(r, existingItem.Version); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		var transition StatusTransition
+		if err := decodeBody(r, &transition); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		item, err := h.Store.Items.Transition(ctx, itemID, existingItem.Version, to, transition.Reason)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeTagged(w, r, http.StatusOK, etag(item.Version), item)
+	}
+}
+
+// GetInventoryStatusHistory lists the status changes of an item, oldest
+// first. Like the ledger, the history of a deleted item can still be read.
+func (h *Handler) GetInventoryStatusHistory(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	itemID, err := parseID(p, "item")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writePage(w, r, statusHistoryQuery, itemHistory(h.Store.Items, itemID, func(ctx context.Context, q repository.ListQuery) ([]entity.StatusChange, int, error) {
+		return h.Store.Items.ListStatusHistory(ctx, itemID, q)
+	}))
 }
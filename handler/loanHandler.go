@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"ngc4/entity"
+	"ngc4/repository"
+	"ngc4/validate"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// loanQuery is what the loan listings can filter and sort on, e.g.
+// ?hero_id=2&sort=due_at.
+var loanQuery = querySpec{
+	filters: map[string]filterParam{
+		"item_id": {"ItemID", "=", integer},
+		"hero_id": {"HeroID", "=", integer},
+		"status":  {"Status", "=", text},
+	},
+	sorts: map[string]string{"id": "ID", "due_at": "DueAt", "checked_out_at": "CheckedOutAt"},
+	fields: map[string]string{"id": "ID", "item_id": "ItemID", "hero_id": "HeroID", "quantity": "Quantity", "status": "Status",
+		"checked_out_at": "CheckedOutAt", "due_at": "DueAt", "returned_at": "ReturnedAt"},
+}
+
+// LoanReturn is the body of POST /avengers/loans/:id/return.
+type LoanReturn struct {
+	// Condition is Broken when the units came back unusable.
+	Condition string `validate:"required,oneof=Good Broken"`
+}
+
+func (h *Handler) GetLoans(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writePage(w, r, loanQuery, h.Store.Loans.List)
+}
+
+// GetOverdueLoans lists the loans still out after their due date.
+func (h *Handler) GetOverdueLoans(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	now := time.Now().UTC().Format(validate.DateTimeLayout)
+
+	writePage(w, r, loanQuery, func(ctx context.Context, q repository.ListQuery) ([]entity.Loan, int, error) {
+		q.Filters = append(q.Filters,
+			repository.Filter{Column: "Status", Op: "=", Value: entity.LoanOut},
+			repository.Filter{Column: "DueAt", Op: "<", Value: now})
+		return h.Store.Loans.List(ctx, q)
+	})
+}
+
+// GetHeroEquipment lists the loans a hero has out.
+func (h *Handler) GetHeroEquipment(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
+
+	heroID, err := parseID(p, "Hero")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if _, err := h.Store.Heroes.FindByID(ctx, heroID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writePage(w, r, loanQuery, func(ctx context.Context, q repository.ListQuery) ([]entity.Loan, int, error) {
+		q.Filters = append(q.Filters,
+			repository.Filter{Column: "HeroID", Op: "=", Value: heroID},
+			repository.Filter{Column: "Status", Op: "=", Value: entity.LoanOut})
+		return h.Store.Loans.List(ctx, q)
+	})
+}
+
+// CheckoutLoan issues units of an Active item to a hero. DueAt is UTC and must
+// lie in the future; there must be enough units in stock, or the checkout is
+// refused with 409.
+func (h *Handler) CheckoutLoan(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := stockContext(r)
+
+	var loan entity.Loan
+	if err := decodeBody(r, &loan); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.checkLoan(ctx, loan); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	item, err := h.Store.Loans.Checkout(ctx, &loan)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	before := item
+	before.Stock += loan.Quantity
+	h.checkReorder(r, before, item)
+
+	writeJSON(w, http.StatusCreated, loan)
+}
+
+// ReturnLoan closes a loan that is out. Units in Good condition go back into
+// stock; Broken ones do not, and are recorded in the ledger of the item
+// without changing its status.
+func (h *Handler) ReturnLoan(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := stockContext(r)
+
+	loanID, err := parseID(p, "loan")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var ret LoanReturn
+	if err := decodeBody(r, &ret); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	loan, err := h.Store.Loans.Return(ctx, loanID, ret.Condition == "Broken")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, loan)
+}
+
+// checkLoan reports a loan of an item or to a hero that does not exist, or one
+// already due, as validation errors. Whether the item is Active is checked by
+// the checkout itself.
+func (h *Handler) checkLoan(ctx context.Context, loan entity.Loan) error {
+	var details []validate.FieldError
+
+	if _, err := h.Store.Items.FindByID(ctx, loan.ItemID); errors.Is(err, repository.ErrNotFound) {
+		details = append(details, validate.FieldError{Field: "ItemID", Rule: "exists", Message: "item does not exist"})
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := h.Store.Heroes.FindByID(ctx, loan.HeroID); errors.Is(err, repository.ErrNotFound) {
+		details = append(details, validate.FieldError{Field: "HeroID", Rule: "exists", Message: "hero does not exist"})
+	} else if err != nil {
+		return err
+	}
+
+	if loan.DueAt <= time.Now().UTC().Format(validate.DateTimeLayout) {
+		details = append(details, validate.FieldError{Field: "DueAt", Rule: "future", Message: "must be in the future"})
+	}
+
+	if len(details) > 0 {
+		return Invalid(details...)
+	}
+	return nil
+}
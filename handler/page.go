@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"ngc4/repository"
+	"ngc4/validate"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLimit is the page size used when a list request sets no limit.
+	DefaultLimit = 50
+	// MaxLimit caps the limit a client may ask for.
+	MaxLimit = 500
+)
+
+// Page is the envelope every list endpoint responds with. NextCursor is null
+// on the last page; otherwise passing it back as ?cursor= returns the rows
+// that follow.
+type Page[T any] struct {
+	Items      []T     `json:"items"`
+	Total      int     `json:"total"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// filterParam turns one query parameter into a repository.Filter on column.
+type filterParam struct {
+	column string
+	op     string
+	parse  func(string) (any, error)
+}
+
+// querySpec whitelists the query parameters of one resource. Nothing else
+// from the query string reaches the SQL.
+type querySpec struct {
+	// filters are the filter parameters of the list endpoint.
+	filters map[string]filterParam
+	// sorts maps the names accepted by ?sort= to columns.
+	sorts map[string]string
+	// fields maps the names accepted by ?fields= to JSON keys.
+	fields map[string]string
+	// includes maps the relations accepted by ?include= to JSON keys.
+	includes map[string]string
+}
+
+// commonParams are accepted by every list endpoint.
+var commonParams = map[string]bool{"limit": true, "offset": true, "cursor": true, "sort": true, "fields": true, "include": true}
+
+func text(v string) (any, error) {
+	return v, nil
+}
+
+func integer(v string) (any, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// dayStart and dayEnd accept a date or a DateTime and return the DateTime
+// that starts or ends the range, so a date-only range includes its last day.
+func dayStart(v string) (any, error) {
+	return dateBound(v, "00:00:00")
+}
+
+func dayEnd(v string) (any, error) {
+	return dateBound(v, "23:59:59")
+}
+
+func dateBound(v, clock string) (any, error) {
+	if _, err := time.Parse(time.DateOnly, v); err == nil {
+		return v + " " + clock, nil
+	}
+	if _, err := time.Parse(validate.DateTimeLayout, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// parseListQuery reads the query string of a list request:
+//
+//	limit   rows per page, 1 to MaxLimit (default DefaultLimit)
+//	offset  rows to skip
+//	cursor  next_cursor of the previous page; cannot be combined with offset
+//	sort    comma separated fields of spec.sorts, "-" prefixed for descending
+//
+// plus the filters of spec. Unknown parameters are rejected. fields and
+// include are read by parseFields and parseInclude.
+func parseListQuery(r *http.Request, spec querySpec) (repository.ListQuery, error) {
+	values := r.URL.Query()
+	q := repository.ListQuery{Limit: DefaultLimit}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if commonParams[name] {
+			continue
+		}
+		v := values.Get(name)
+
+		param, ok := spec.filters[name]
+		if !ok {
+			return q, BadRequest("Unknown query parameter " + strconv.Quote(name) + "; filters: " + strings.Join(sortedKeys(spec.filters), ", "))
+		}
+		value, err := param.parse(v)
+		if err != nil {
+			return q, BadRequest("Invalid value for " + name + ": " + strconv.Quote(v))
+		}
+		q.Filters = append(q.Filters, repository.Filter{Column: param.column, Op: param.op, Value: value})
+	}
+
+	if v := values.Get("sort"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			key := repository.SortKey{}
+			if strings.HasPrefix(field, "-") {
+				key.Desc = true
+				field = field[1:]
+			}
+			column, ok := spec.sorts[field]
+			if !ok {
+				return q, BadRequest("Cannot sort by " + strconv.Quote(field) + "; sort fields: " + strings.Join(sortedKeys(spec.sorts), ", "))
+			}
+			key.Column = column
+			q.Sort = append(q.Sort, key)
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return q, BadRequest("limit must be a number between 1 and " + strconv.Itoa(MaxLimit))
+		}
+		q.Limit = limit
+	}
+
+	if v := values.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return q, BadRequest("offset must be a non-negative number")
+		}
+		q.Offset = offset
+	}
+
+	return q, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Cursors are the sort key values of the last row of a page, encoded so that
+// clients treat them as opaque.
+func encodeCursor(values []any) string {
+	raw, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor reads a cursor for q. Its values must match the types of the
+// sort keys of q in zero, an empty entity, so a cursor taken under another
+// sort order is rejected.
+func decodeCursor(cursor string, q repository.ListQuery, zero any) ([]any, error) {
+	invalid := BadRequest("Invalid cursor; it must come from a page with the same sort")
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var values []any
+	if err := dec.Decode(&values); err != nil {
+		return nil, invalid
+	}
+
+	want := q.KeyValues(zero)
+	if len(values) != len(want) {
+		return nil, invalid
+	}
+	for i, v := range values {
+		switch want[i].(type) {
+		case int:
+			n, ok := v.(json.Number)
+			if !ok {
+				return nil, invalid
+			}
+			i64, err := n.Int64()
+			if err != nil {
+				return nil, invalid
+			}
+			values[i] = int(i64)
+		default:
+			if reflect.TypeOf(v) != reflect.TypeOf(want[i]) {
+				return nil, invalid
+			}
+		}
+	}
+	return values, nil
+}
+
+// writePage serves one page of a list endpoint. It asks list for one row more
+// than the limit to learn whether a next page exists.
+func writePage[T any](w http.ResponseWriter, r *http.Request, spec querySpec,
+	list func(context.Context, repository.ListQuery) ([]T, int, error)) {
+	q, err := parseListQuery(r, spec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	fields, err := parseFields(r, spec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		if q.Offset != 0 {
+			writeError(w, r, BadRequest("cursor and offset cannot be combined"))
+			return
+		}
+		var zero T
+		if q.After, err = decodeCursor(cursor, q, zero); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	limit := q.Limit
+	q.Limit++
+	rows, total, err := list(r.Context(), q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	page := Page[T]{Items: rows, Total: total}
+	if len(rows) > limit {
+		page.Items = rows[:limit]
+		cursor := encodeCursor(q.KeyValues(page.Items[limit-1]))
+		page.NextCursor = &cursor
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+
+	if fields != nil {
+		items := make([]any, len(page.Items))
+		for i, item := range page.Items {
+			items[i] = project(item, fields)
+		}
+		writeJSON(w, http.StatusOK, Page[any]{Items: items, Total: page.Total, NextCursor: page.NextCursor})
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
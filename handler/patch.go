@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"ngc4/validate"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// The patch formats accepted by every PATCH route, chosen by Content-Type.
+const (
+	// MergePatchType is a JSON Merge Patch (RFC 7396): an object whose
+	// members replace those of the resource, null removing them.
+	MergePatchType = "application/merge-patch+json"
+	// JSONPatchType is a JSON Patch (RFC 6902): an array of add, remove,
+	// replace, move, copy and test operations.
+	JSONPatchType = "application/json-patch+json"
+)
+
+// applyPatch applies the body of a PATCH request to current, an entity, and
+// returns the result, checked against the validate tags of T like a PUT body.
+// Fields the patch does not mention keep their current values. So do ID,
+// which comes from the URL, and Version, which comes from the store: a patch
+// cannot change either.
+func applyPatch[T any](w http.ResponseWriter, r *http.Request, current T) (T, error) {
+	var patched T
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != MergePatchType && mediaType != JSONPatchType {
+		w.Header().Set("Accept-Patch", MergePatchType+", "+JSONPatchType)
+		return patched, UnsupportedMediaType("PATCH takes " + MergePatchType + " or " + JSONPatchType)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return patched, BadRequest("Invalid request body: " + err.Error())
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return patched, err
+	}
+
+	if mediaType == MergePatchType {
+		doc, err = jsonpatch.MergePatch(doc, body)
+		if err != nil {
+			return patched, BadRequest("Invalid merge patch: " + err.Error())
+		}
+	} else {
+		ops, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return patched, BadRequest("Invalid JSON patch: " + err.Error())
+		}
+		doc, err = ops.Apply(doc)
+		switch {
+		case errors.Is(err, jsonpatch.ErrTestFailed), errors.Is(err, jsonpatch.ErrMissing):
+			return patched, Conflict("JSON patch does not apply to the current resource: "+err.Error(), err)
+		case err != nil:
+			return patched, BadRequest("Invalid JSON patch: " + err.Error())
+		}
+	}
+
+	// The patched document must still be a valid resource: no unknown
+	// members and no values of the wrong type.
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patched); err != nil {
+		return patched, Validation("patched resource is invalid: " + err.Error())
+	}
+
+	for _, name := range []string{"ID", "Version"} {
+		reflect.ValueOf(&patched).Elem().FieldByName(name).Set(reflect.ValueOf(current).FieldByName(name))
+	}
+	return patched, validate.Struct(patched)
+}
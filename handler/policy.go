@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"ngc4/auth"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// permission allows calling the routes registered with Method and Path in
+// NewRouter. Method "*" is any method; a Path ending in "*" is a prefix, so
+// "/avengers/inventory*" covers /avengers/inventory and every route below it.
+type permission struct {
+	Method string
+	Path   string
+}
+
+// policy is what each role may do. A route no permission of the role of the
+// token covers is answered with 403.
+var policy = map[string][]permission{
+	auth.RoleAnalyst: {
+		{http.MethodGet, "*"},
+	},
+	auth.RoleFieldAgent: {
+		{http.MethodGet, "*"},
+		{http.MethodPost, "/avengers/crimeevent"},
+	},
+	// Loans move stock in and out, so they belong to the quartermaster too.
+	auth.RoleQuartermaster: {
+		{http.MethodGet, "*"},
+		{"*", "/avengers/inventory*"},
+		{http.MethodPost, "/avengers/loans*"},
+	},
+	auth.RoleAdmin: {
+		{"*", "*"},
+	},
+}
+
+func (p permission) allows(method, path string) bool {
+	if p.Method != "*" && p.Method != method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(p.Path, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return p.Path == path
+}
+
+// rolesFor returns the roles that may call the route registered with method
+// and path.
+func rolesFor(method, path string) map[string]bool {
+	roles := map[string]bool{}
+	for role, permissions := range policy {
+		for _, p := range permissions {
+			if p.allows(method, path) {
+				roles[role] = true
+			}
+		}
+	}
+	return roles
+}
+
+// Authorize wraps next, the handler registered with method and path, so that
+// it only runs for the roles policy allows. It must run behind Authenticate,
+// which puts the claims of the token into the request context.
+func Authorize(method, path string, next httprouter.Handle) httprouter.Handle {
+	roles := rolesFor(method, path)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		claims, ok := auth.ClaimsFrom(r.Context())
+		if !ok || !roles[claims.Role] {
+			role := "anonymous"
+			if ok {
+				role = claims.Role
+			}
+			writeError(w, r, Forbidden(fmt.Sprintf("role %q may not %s %s", role, method, path)))
+			return
+		}
+		next(w, r, p)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"ngc4/entity"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// NewRouter registers every /avengers route on a new router.
+func NewRouter(h *Handler) *httprouter.Router {
+	router := httprouter.New()
+	router.PanicHandler = Panic
+	router.NotFound = NotFoundHandler()
+	router.MethodNotAllowed = MethodNotAllowedHandler()
+
+	router.POST("/avengers/login", h.Login)
+
+	// Every other route needs a bearer token whose role policy allows the
+	// route.
+	route := func(method, path string, handle httprouter.Handle) {
+		router.Handle(method, path, h.Authenticate(Authorize(method, path, handle)))
+	}
+
+	route("GET", "/avengers/inventory", h.GetInventory)
+	route("GET", "/avengers/inventory/:id", h.GetInventoryByID)
+	route("POST", "/avengers/inventory", h.CreateInventory)
+	route("DELETE", "/avengers/inventory/:id", h.DeleteInventoryByID)
+	route("PUT", "/avengers/inventory/:id", h.UpdateInventoryID)
+	route("PATCH", "/avengers/inventory/:id", h.PatchInventoryByID)
+	route("POST", "/avengers/inventory/:id/adjust", h.AdjustInventoryByID)
+	// GET /avengers/inventory/code/:code, /:id/movements and
+	// /:id/status-history; see GetInventorySubresource.
+	route("GET", "/avengers/inventory/:id/:sub", h.GetInventorySubresource)
+	route("POST", "/avengers/inventory/:id/break", h.TransitionInventory(entity.ItemBroken))
+	route("POST", "/avengers/inventory/:id/repair", h.TransitionInventory(entity.ItemInRepair))
+	route("POST", "/avengers/inventory/:id/restore", h.TransitionInventory(entity.ItemActive))
+	route("POST", "/avengers/inventory/:id/retire", h.TransitionInventory(entity.ItemRetired))
+
+	route("GET", "/avengers/crimeevent", h.GetCrimeEvent)
+	route("GET", "/avengers/crimeevent/:id", h.GetCrimeEventByID)
+	route("POST", "/avengers/crimeevent", h.CreateCrimeEvent)
+	route("DELETE", "/avengers/crimeevent/:id", h.DeleteCrimeEventByID)
+	route("PUT", "/avengers/crimeevent/:id", h.UpdateCrimeEventByID)
+	route("PATCH", "/avengers/crimeevent/:id", h.PatchCrimeEventByID)
+
+	route("GET", "/avengers/heroes", h.GetHeroes)
+	route("GET", "/avengers/heroes/:id", h.GetHeroesByID)
+	route("POST", "/avengers/heroes", h.CreateHero)
+	route("DELETE", "/avengers/heroes/:id", h.DeleteHeroByID)
+	route("PUT", "/avengers/heroes/:id", h.UpdateHeroByID)
+	route("PATCH", "/avengers/heroes/:id", h.PatchHeroByID)
+	route("GET", "/avengers/heroes/:id/equipment", h.GetHeroEquipment)
+
+	route("GET", "/avengers/villain", h.GetVillain)
+	route("GET", "/avengers/villain/:id", h.GetVillainByID)
+	route("POST", "/avengers/villain", h.CreateVillain)
+	route("DELETE", "/avengers/villain/:id", h.DeleteVillainByID)
+	route("PUT", "/avengers/villain/:id", h.UpdateVillainByID)
+	route("PATCH", "/avengers/villain/:id", h.PatchVillainByID)
+
+	route("GET", "/avengers/loans", h.GetLoans)
+	route("GET", "/avengers/loans/overdue", h.GetOverdueLoans)
+	route("POST", "/avengers/loans", h.CheckoutLoan)
+	route("POST", "/avengers/loans/:id/return", h.ReturnLoan)
+
+	return router
+}
@@ -1,230 +1,169 @@
 package handler
 
 import (
-	"context"
-	"database/sql"
-	"encoding/json"
-	"log"
 	"net/http"
-	"ngc4/config"
 	"ngc4/entity"
-	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-func GetVillain(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed connecting to Database")
-	}
-	defer db.Close()
+// villainQuery is what GET /avengers/villain can filter and sort on.
+var villainQuery = querySpec{
+	filters: map[string]filterParam{
+		"name":     {"Name", "=", text},
+		"universe": {"Universe", "=", text},
+	},
+	sorts:  map[string]string{"id": "ID", "name": "Name", "universe": "Universe"},
+	fields: map[string]string{"id": "ID", "version": "Version", "name": "Name", "universe": "Universe", "image_url": "ImageURL"},
+}
 
-	ctx := context.Background()
-	var villain []entity.Villain
+func (h *Handler) GetVillain(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writePage(w, r, villainQuery, h.Store.Villains.List)
+}
 
-	query := `
-		SELECT ID, Name, Universe, ImageURL FROM villain
-	`
+func (h *Handler) GetVillainByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-	rows, err := db.QueryContext(ctx, query)
+	fields, err := parseFields(r, villainQuery)
 	if err != nil {
-		panic(err)
+		writeError(w, r, err)
+		return
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		v := entity.Villain{}
-		err := rows.Scan(&v.ID, &v.Name, &v.Universe, &v.ImageURL)
-		if err != nil {
-			panic(err)
-		}
 
-		villain = append(villain, v)
+	id, err := parseID(p, "Villain")
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(villain)
-}
-
-func GetVillainByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+	villain, err := h.Store.Villains.FindByID(ctx, id)
 	if err != nil {
-		log.Fatal("Failed connecting to Database")
+		writeError(w, r, err)
+		return
 	}
-	defer db.Close()
 
-	ctx := context.Background()
-	var villain entity.Villain
+	writeTagged(w, r, http.StatusOK, etag(villain.Version), project(villain, fields))
+}
 
-	id := p.ByName("id")
+func (h *Handler) CreateVillain(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
+	var villain entity.Villain
 
-	query := `
-		SELECT ID, Name, Universe, ImageURL FROM villain WHERE ID = ?
-	`
+	if err := decodeBody(r, &villain); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	row := db.QueryRowContext(ctx, query, id)
-	err = row.Scan(&villain.ID, &villain.Name, &villain.Universe, &villain.ImageURL)
+	// The ID is always generated by the store.
+	villain.ID = 0
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.NotFound(w, r)
-			return
-		}
-		panic(err)
+	if err := h.Store.Villains.Create(ctx, &villain); err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(villain)
+	writeTagged(w, r, http.StatusCreated, etag(villain.Version), villain)
 }
 
-func CreateVillain(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed connecting to Database")
-	}
-	defer db.Close()
+func (h *Handler) DeleteVillainByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-	ctx := context.Background()
-	var villain entity.Villain
-
-	err = json.NewDecoder(r.Body).Decode(&villain)
+	villainID, err := parseID(p, "Villain")
 	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadGateway)
+		writeError(w, r, err)
 		return
 	}
 
-	query := `
-		INSERT INTO villain (Name, Universe, ImageURL)
-		VALUES (?, ?, ?)
-	`
-
-	result, err := db.ExecContext(ctx, query, villain.Name, villain.Universe, villain.ImageURL)
+	existingVillain, err := h.Store.Villains.FindByID(ctx, villainID)
 	if err != nil {
-		http.Error(w, "Failed to create Villain", http.StatusBadGateway)
-		log.Println("Error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	id, _ := result.LastInsertId()
+	if err := checkIfMatch(r, existingVillain.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	villain.ID = int(id)
+	if err := h.Store.Villains.Delete(ctx, villainID, existingVillain.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(villain)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func DeleteVillainByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
-	if err != nil {
-		log.Fatal("Failed connecting to Database")
-	}
-	defer db.Close()
-
-	ctx := context.Background()
+func (h *Handler) UpdateVillainByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-	id := p.ByName("id")
-	villainID, err := strconv.Atoi(id)
+	villainID, err := parseID(p, "Villain")
 	if err != nil {
-		http.Error(w, "Invalid Villain ID", http.StatusBadGateway)
+		writeError(w, r, err)
 		return
 	}
 
-	existingVillain, err := GetVByID(ctx, db, villainID)
+	existingVillain, err := h.Store.Villains.FindByID(ctx, villainID)
 	if err != nil {
-		http.Error(w, "Failed to retrieve existing Villain ID", http.StatusBadGateway)
+		writeError(w, r, err)
 		return
 	}
 
-	if existingVillain.ID == 0 {
-		http.NotFound(w, r)
+	if err := checkIfMatch(r, existingVillain.Version); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	err = DeleteVillain(ctx, db, villainID)
-	if err != nil {
-		http.Error(w, "Failed to delete Villain", http.StatusBadGateway)
+	var updateVillain entity.Villain
+	if err := decodeBody(r, &updateVillain); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNoContent)
-}
-
-func GetVByID(ctx context.Context, db *sql.DB, id int) (entity.Villain, error) {
-	var villain entity.Villain
+	existingVillain.Name = updateVillain.Name
+	existingVillain.Universe = updateVillain.Universe
+	existingVillain.ImageURL = updateVillain.ImageURL
 
-	query := `
-		SELECT ID, Name, Universe, ImageURL FROM villain
-		WHERE ID = ?
-	`
+	if err := h.Store.Villains.Update(ctx, existingVillain); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	row := db.QueryRowContext(ctx, query, id)
-	err := row.Scan(&villain.ID, &villain.Name, &villain.Universe, &villain.ImageURL)
-	return villain, err
+	existingVillain.Version++
+	writeTagged(w, r, http.StatusOK, etag(existingVillain.Version), existingVillain)
 }
 
-func DeleteVillain(ctx context.Context, db *sql.DB, id int) error {
-	query := `
-        DELETE FROM villain
-        WHERE ID = ?
-    `
-	_, err := db.ExecContext(ctx, query, id)
-	return err
-}
+// PatchVillainByID applies the request's patch to a villain.
+func (h *Handler) PatchVillainByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
 
-func UpdateVillainByID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	db, err := config.GetDB()
+	villainID, err := parseID(p, "Villain")
 	if err != nil {
-		log.Fatal("Failed connecting to Database")
+		writeError(w, r, err)
+		return
 	}
-	defer db.Close()
-
-	ctx := context.Background()
 
-	id := p.ByName("id")
-	villainID, err := strconv.Atoi(id)
+	existingVillain, err := h.Store.Villains.FindByID(ctx, villainID)
 	if err != nil {
-		http.Error(w, "Invalid Villain ID", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	existingVillain, err := GetVByID(ctx, db, villainID)
-	if err != nil {
-		http.Error(w, "Failed to retrieve Villain", http.StatusInternalServerError)
-		log.Println("Error:", err)
+	if err := checkIfMatch(r, existingVillain.Version); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	var updateVillain entity.Villain
-	err = json.NewDecoder(r.Body).Decode(&updateVillain)
+	patchedVillain, err := applyPatch(w, r, existingVillain)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	existingVillain.Name = updateVillain.Name
-	existingVillain.Universe = updateVillain.Universe
-	existingVillain.ImageURL = updateVillain.ImageURL
-
-	err = updateVillainDB(ctx, db, existingVillain)
-	if err != nil {
-		http.Error(w, "Failed to Villain", http.StatusInternalServerError)
-		log.Println("Error:", err)
+	if err := h.Store.Villains.Update(ctx, patchedVillain); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(existingVillain)
-}
-
-func updateVillainDB(ctx context.Context, db *sql.DB, villain entity.Villain) error {
-	query := `
-        UPDATE villain
-        SET Name = ?, Universe = ?, ImageURL = ?
-        WHERE ID = ?
-    `
-	_, err := db.ExecContext(ctx, query, villain.Name, villain.Universe, villain.ImageURL, villain.ID)
-	return err
+	patchedVillain.Version++
+	writeTagged(w, r, http.StatusOK, etag(patchedVillain.Version), patchedVillain)
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"ngc4/auth"
+	"os"
+	"strings"
+)
+
+// hashPassword implements "ngc4 hash-password": it reads a password from the
+// first line of standard input and prints its bcrypt hash for the
+// password_hash of a user in the config file.
+func hashPassword() {
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		log.Fatal("hash-password: no password on standard input")
+	}
+	if len(password) > 72 {
+		log.Fatal("hash-password: bcrypt only uses the first 72 bytes of a password")
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(hash)
+}
@@ -1,54 +1,224 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"ngc4/auth"
 	"ngc4/config"
 	"ngc4/handler"
-
-	"github.com/julienschmidt/httprouter"
+	"ngc4/migration"
+	"ngc4/repository"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
+var cfg config.Config
+
 func main() {
-	db, err := config.GetDB()
+	var args []string
+	var err error
+	cfg, args, err = config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal("Failed connecting to Database")
+		log.Fatal("Invalid configuration: ", err)
 	}
-	defer db.Close()
 
-	router := httprouter.New()
+	level, _ := cfg.Level()
+	logHandler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(logHandler))
+	// SetDefault bridges the log package at Info level, but this package only
+	// uses log for the fatal errors of the commands.
+	log.SetOutput(slog.NewLogLogger(logHandler, slog.LevelError).Writer())
 
-	router.GET("/avengers/inventory", handler.GetInventory)
-	router.GET("/avengers/inventory/:id", handler.GetInventoryByID)
-	router.POST("/avengers/inventory", handler.CreateInventory)
-	router.DELETE("/avengers/inventory/:id", handler.DeleteInventoryByID)
-	router.PUT("/avengers/inventory/:id", handler.UpdateInventoryID)
+	cmd := ""
+	if len(args) > 0 {
+		cmd = args[0]
+	}
 
-	router.GET("/avengers/crimeevent", handler.GetCrimeEvent)
-	router.GET("/avengers/crimeevent/:id", handler.GetCrimeEventByID)
-	router.POST("/avengers/crimeevent", handler.CreateCrimeEvent)
-	router.DELETE("/avengers/crimeevent/:id", handler.DeleteCrimeEventByID)
-	router.PUT("/avengers/crimeevent/:id", handler.UpdateCrimeEventByID)
+	switch cmd {
+	case "", "serve":
+		serve()
+	case "migrate":
+		migrate(args[1:])
+	case "seed":
+		seedFixtures(args[1:])
+	case "reconcile":
+		reconcile()
+	case "hash-password":
+		hashPassword()
+	default:
+		log.Fatalf("Unknown command %q; run with -h for usage", cmd)
+	}
+}
 
-	router.GET("/avengers/heroes", handler.GetHeroes)
-	router.GET("/avengers/heroes/:id", handler.GetHeroesByID)
-	router.POST("/avengers/heroes", handler.CreateHero)
-	router.DELETE("/avengers/heroes/:id", handler.DeleteHeroByID)
-	router.PUT("/avengers/heroes/:id", handler.UpdateHeroByID)
+// openDB connects to the SQL backend selected by the storage setting.
+func openDB() (*sql.DB, repository.Dialect, error) {
+	dialect, err := repository.DialectFor(cfg.Storage)
+	if err != nil {
+		return nil, dialect, err
+	}
 
-	router.GET("/avengers/villain", handler.GetVillain)
-	router.GET("/avengers/villain/:id", handler.GetVillainByID)
-	router.POST("/avengers/villain", handler.CreateVillain)
-	router.DELETE("/avengers/villain/:id", handler.DeleteVillainByID)
-	router.PUT("/avengers/villain/:id", handler.UpdateVillainByID)
+	dbConfig := cfg.DB
+	dbConfig.Driver = dialect.Driver
+	db, err := config.GetDB(dbConfig)
+	if err != nil {
+		return nil, dialect, err
+	}
+	return db, dialect, nil
+}
 
-	server := http.Server{
-		Addr:    "localhost:8080",
-		Handler: router,
+// itemCodes is the configured generator for codes of items created without
+// one.
+func itemCodes() repository.ItemCodes {
+	return repository.ItemCodes{Prefix: cfg.ItemCode.Prefix, Width: cfg.ItemCode.Width}
+}
+
+// loadTokens reads the configured signing keys. Both are loaded when both
+// are set, so tokens signed with either stay valid.
+func loadTokens() (*auth.Tokens, error) {
+	opts := auth.Options{Algorithm: cfg.Auth.Algorithm, Issuer: cfg.Auth.Issuer, TTL: time.Duration(cfg.Auth.TokenTTL)}
+	var err error
+	switch {
+	case cfg.Auth.HMACKeyFile != "":
+		if opts.HMACKey, err = auth.LoadHMACKey(cfg.Auth.HMACKeyFile); err != nil {
+			return nil, err
+		}
+	case cfg.Auth.HMACKey != "":
+		opts.HMACKey = []byte(strings.TrimSpace(cfg.Auth.HMACKey))
+	case cfg.Auth.Algorithm == auth.HS256:
+		return nil, errors.New("HS256 needs a secret: set -auth-hmac-key-file, or NGC4_AUTH_HMAC_KEY when running locally (see README.md)")
+	}
+	if cfg.Auth.RSAKeyFile != "" {
+		if opts.RSAKey, err = auth.LoadRSAKey(cfg.Auth.RSAKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	return auth.NewTokens(opts)
+}
+
+// loadUsers returns the accounts of the config file and the admin account
+// set up from the environment.
+func loadUsers() (auth.Users, error) {
+	var users []auth.User
+	for _, u := range cfg.Auth.Users {
+		users = append(users, auth.User{Username: u.Username, PasswordHash: u.PasswordHash, Role: u.Role})
+	}
+	if cfg.Auth.AdminPasswordHash != "" {
+		users = append(users, auth.User{Username: "admin", PasswordHash: cfg.Auth.AdminPasswordHash, Role: auth.RoleAdmin})
+	}
+	if len(users) == 0 {
+		slog.Warn("no users configured, nobody can log in; list auth.users in the config file or set NGC4_AUTH_ADMIN_PASSWORD_HASH (see README.md)")
+	}
+	return auth.NewUsers(users)
+}
+
+func serve() {
+	var store repository.Store
+	var db *sql.DB
+	switch cfg.Storage {
+	case "memory":
+		store = repository.NewMemoryStore(itemCodes())
+	default:
+		var dialect repository.Dialect
+		var err error
+		db, dialect, err = openDB()
+		if err != nil {
+			log.Fatal("Failed connecting to Database: ", err)
+		}
+
+		// A SQLite file is usually a throwaway demo database, so bring its
+		// schema up to date on start. Other backends are migrated explicitly.
+		if dialect.Name == repository.SQLite.Name {
+			m, err := migration.New(db, dialect)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, err := m.Up(context.Background()); err != nil {
+				log.Fatal("Failed migrating database: ", err)
+			}
+		}
+
+		store = repository.NewSQLStore(db, dialect, itemCodes())
 	}
 
-	err = server.ListenAndServe()
+	tokens, err := loadTokens()
+	if err != nil {
+		log.Fatal("Failed loading token keys: ", err)
+	}
+	users, err := loadUsers()
 	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+
+	h := handler.NewHandler(store)
+	h.Tokens = tokens
+	h.Users = users
+	var webhook *handler.WebhookAlerter
+	if cfg.StockAlertWebhook != "" {
+		webhook = handler.NewWebhookAlerter(cfg.StockAlertWebhook)
+		h.Alerts = handler.Alerters{handler.LogAlerter{}, webhook}
+	}
+
+	router := handler.NewRouter(h)
+
+	server := http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           handler.RequestID(router),
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", cfg.ListenAddr, "storage", cfg.Storage)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if db != nil {
+			db.Close()
+		}
 		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Stop accepting connections and give in-flight requests the drain
+	// period to finish before the pool they write through is closed.
+	slog.Info("shutting down", "drain", cfg.ShutdownTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	if err := server.Shutdown(drainCtx); err != nil {
+		slog.Error("drain period expired, closing remaining connections", "error", err)
+		server.Close()
+	}
+	// Alerts raised by the drained requests are still queued.
+	if webhook != nil {
+		if err := webhook.Close(drainCtx); err != nil {
+			slog.Error("drain period expired, dropping stock alerts", "error", err)
+		}
+	}
+	if db != nil {
+		if err := db.Close(); err != nil {
+			slog.Error("closing database", "error", err)
+		}
 	}
+	slog.Info("stopped")
 }
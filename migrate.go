@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"ngc4/migration"
+	"strconv"
+)
+
+// migrate implements "ngc4 migrate up|down [n]|status".
+func migrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal("migrate needs a subcommand: up, down [n] or status")
+	}
+	if cfg.Storage == "memory" {
+		log.Fatal("migrate needs a SQL backend; the memory store has no schema")
+	}
+
+	db, dialect, err := openDB()
+	if err != nil {
+		log.Fatal("Failed connecting to Database: ", err)
+	}
+	defer db.Close()
+
+	m, err := migration.New(db, dialect)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		done, err := m.Up(ctx)
+		for _, mg := range done {
+			fmt.Printf("applied %04d_%s\n", mg.Version, mg.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("invalid step count %q", args[1])
+			}
+		}
+		done, err := m.Down(ctx, steps)
+		for _, mg := range done {
+			fmt.Printf("reverted %04d_%s\n", mg.Version, mg.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+	default:
+		log.Fatalf("unknown migrate subcommand %q", args[0])
+	}
+}
@@ -0,0 +1,282 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"ngc4/repository"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed sql
+var files embed.FS
+
+// Migration is one numbered schema change with the SQL to apply and revert
+// it. Files live in sql/<dialect>/<version>_<name>.up.sql and .down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a migration has been applied to the database.
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Load returns the embedded migrations for a dialect, ordered by version.
+func Load(dialect string) ([]Migration, error) {
+	dir := path.Join("sql", dialect)
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %q", dialect)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version %q", name, prefix)
+		}
+
+		body, err := fs.ReadFile(files, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if m.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrator applies and reverts the embedded migrations, recording progress
+// in the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	dialect    repository.Dialect
+	migrations []Migration
+}
+
+func New(db *sql.DB, dialect repository.Dialect) (*Migrator, error) {
+	migrations, err := Load(dialect.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+	_, err := m.db.ExecContext(ctx, query)
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]bool, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		status = append(status, Status{Migration: mg, Applied: applied[mg.Version]})
+	}
+	return status, nil
+}
+
+// Up applies every pending migration in version order and returns the ones
+// it ran.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mg := range m.migrations {
+		if applied[mg.Version] {
+			continue
+		}
+
+		record := m.dialect.Rebind(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`)
+		if err := m.run(ctx, mg.Up, record, mg.Version, mg.Name); err != nil {
+			return done, fmt.Errorf("migration %d_%s up: %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Down reverts the most recently applied migrations, at most steps of them,
+// and returns the ones it ran.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mg := m.migrations[i]
+		if !applied[mg.Version] {
+			continue
+		}
+
+		record := m.dialect.Rebind(`DELETE FROM schema_migrations WHERE version = ?`)
+		if err := m.run(ctx, mg.Down, record, mg.Version); err != nil {
+			return done, fmt.Errorf("migration %d_%s down: %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// run executes a migration script and the schema_migrations bookkeeping in
+// one transaction. MySQL commits DDL implicitly, so there a failed script can
+// leave earlier statements applied.
+//
+// SQLite can only change a constraint by rebuilding the table, which must not
+// cascade into the tables referencing it. Its scripts therefore run with
+// foreign keys off and are checked with foreign_key_check before commit, as
+// the SQLite documentation on ALTER TABLE describes.
+func (m *Migrator) run(ctx context.Context, script, record string, args ...any) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sqlite := m.dialect.Name == repository.SQLite.Name
+	if sqlite {
+		if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), `PRAGMA foreign_keys = ON`)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range split(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	if sqlite {
+		rows, err := tx.QueryContext(ctx, `PRAGMA foreign_key_check`)
+		if err != nil {
+			return err
+		}
+		broken := rows.Next()
+		rows.Close()
+		if broken {
+			return fmt.Errorf("migration leaves rows with broken foreign keys")
+		}
+	}
+	return tx.Commit()
+}
+
+// split breaks a script into statements on semicolons that end a line. The
+// MySQL driver refuses multi-statement strings, so each one is sent alone.
+func split(script string) []string {
+	var stmts []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
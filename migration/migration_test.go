@@ -0,0 +1,117 @@
+package migration_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"ngc4/config"
+	"ngc4/migration"
+	"ngc4/repository"
+	"path/filepath"
+	"testing"
+)
+
+// openSQLite returns a migrator for an empty SQLite database in a temporary
+// file, opened the way the server opens it.
+func openSQLite(t *testing.T) (*sql.DB, *migration.Migrator) {
+	t.Helper()
+
+	db, err := config.GetDB(config.DBConfig{Driver: repository.SQLite.Driver, Name: filepath.Join(t.TempDir(), "ngc4.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migration.New(db, repository.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, m
+}
+
+// downTo reverts the migrations after version.
+func downTo(t *testing.T, m *migration.Migrator, version int) {
+	t.Helper()
+
+	status, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := 0
+	for _, s := range status {
+		if s.Applied && s.Version > version {
+			steps++
+		}
+	}
+	if _, err := m.Down(context.Background(), steps); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestUpDown applies every migration, reverts them all and applies them
+// again.
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	_, m := openSQLite(t)
+
+	all, err := migration.Load(repository.SQLite.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for round := 1; round <= 2; round++ {
+		done, err := m.Up(ctx)
+		if err != nil || len(done) != len(all) {
+			t.Fatalf("round %d: Up() ran %d of %d migrations: %v", round, len(done), len(all), err)
+		}
+		done, err = m.Down(ctx, len(all))
+		if err != nil || len(done) != len(all) {
+			t.Fatalf("round %d: Down() ran %d of %d migrations: %v", round, len(done), len(all), err)
+		}
+	}
+}
+
+// TestUniqueItemCodeDuplicates upgrades a database whose items share codes,
+// as they could before codes were unique.
+func TestUniqueItemCodeDuplicates(t *testing.T) {
+	ctx := context.Background()
+	db, m := openSQLite(t)
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	downTo(t, m, 5)
+
+	for i, code := range []string{"CODE001", "CODE001", "CODE002", "CODE001", "CODE002"} {
+		_, err := db.ExecContext(ctx, `INSERT INTO item (Name, ItemCode, Stock, Status) VALUES (?, ?, 1, 'Active')`,
+			fmt.Sprint("Item ", i+1), code)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up() with duplicate codes: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT ItemCode FROM item ORDER BY ID`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"CODE001", "CODE001-2", "CODE002", "CODE001-4", "CODE002-5"}
+	if fmt.Sprint(codes) != fmt.Sprint(want) {
+		t.Errorf("codes after Up() = %q, want %q", codes, want)
+	}
+}
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS heroes (
+    ID INT PRIMARY KEY AUTO_INCREMENT,
+    Name VARCHAR(255) NOT NULL,
+    Universe VARCHAR(255) NOT NULL,
+    Skill VARCHAR(255),
+    ImageURL VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS villain (
+    ID INT PRIMARY KEY AUTO_INCREMENT,
+    Name VARCHAR(255) NOT NULL,
+    Universe VARCHAR(255) NOT NULL,
+    ImageURL VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS crimeevent (
+    ID INT PRIMARY KEY AUTO_INCREMENT,
+    HeroID INT,
+    VillainID INT,
+    Description TEXT,
+    DateTime DATETIME,
+    FOREIGN KEY (HeroID) REFERENCES heroes(ID),
+    FOREIGN KEY (VillainID) REFERENCES villain(ID)
+);
+
+CREATE TABLE IF NOT EXISTS item (
+    ID INT PRIMARY KEY AUTO_INCREMENT,
+    Name VARCHAR(255) NOT NULL,
+    ItemCode VARCHAR(50) NOT NULL,
+    Stock INT NOT NULL,
+    Description VARCHAR(255),
+    Status VARCHAR(50) NOT NULL,
+    CONSTRAINT item_status_check CHECK (Status IN ('Active', 'Broken'))
+);
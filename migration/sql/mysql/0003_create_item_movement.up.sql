@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS item_movement (
+    ID INT PRIMARY KEY AUTO_INCREMENT,
+    ItemID INT NOT NULL,
+    Delta INT NOT NULL,
+    Stock INT NOT NULL,
+    Reason VARCHAR(255) NOT NULL,
+    Actor VARCHAR(255) NOT NULL,
+    CreatedAt DATETIME NOT NULL,
+    FOREIGN KEY (ItemID) REFERENCES item(ID) ON DELETE CASCADE
+);
+
+INSERT INTO item_movement (ItemID, Delta, Stock, Reason, Actor, CreatedAt)
+SELECT ID, Stock, Stock, 'opening balance', 'migration', CURRENT_TIMESTAMP FROM item;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS loan (
+    ID INT PRIMARY KEY AUTO_INCREMENT,
+    ItemID INT NOT NULL,
+    HeroID INT NOT NULL,
+    Quantity INT NOT NULL,
+    Status VARCHAR(50) NOT NULL,
+    CheckedOutAt DATETIME NOT NULL,
+    DueAt DATETIME NOT NULL,
+    ReturnedAt DATETIME NULL,
+    FOREIGN KEY (ItemID) REFERENCES item(ID),
+    FOREIGN KEY (HeroID) REFERENCES heroes(ID),
+    CONSTRAINT loan_quantity_check CHECK (Quantity > 0),
+    CONSTRAINT loan_status_check CHECK (Status IN ('Out', 'Returned', 'Broken'))
+);
+
+CREATE INDEX loan_status_due_idx ON loan (Status, DueAt);
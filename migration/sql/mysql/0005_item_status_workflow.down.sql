@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS item_status_history;
+
+-- The old constraint only knows Active and Broken; items in repair or retired
+-- count as broken.
+UPDATE item SET Status = 'Broken' WHERE Status IN ('InRepair', 'Retired');
+
+ALTER TABLE item DROP CHECK item_status_check;
+
+ALTER TABLE item ADD CONSTRAINT item_status_check CHECK (Status IN ('Active', 'Broken'));
@@ -0,0 +1,31 @@
+-- A database created from the old query/query.sql has the status CHECK under
+-- the name MySQL generated for it, item_chk_1, and 0001 keeps that table, so
+-- the constraint is dropped by whatever name it has.
+SET @drop_status_check = COALESCE((
+    SELECT CONCAT('ALTER TABLE item DROP CHECK `', CONSTRAINT_NAME, '`')
+    FROM information_schema.TABLE_CONSTRAINTS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'item' AND CONSTRAINT_TYPE = 'CHECK'
+    LIMIT 1
+), 'SELECT 1');
+
+PREPARE drop_status_check FROM @drop_status_check;
+
+EXECUTE drop_status_check;
+
+DEALLOCATE PREPARE drop_status_check;
+
+ALTER TABLE item ADD CONSTRAINT item_status_check CHECK (Status IN ('Active', 'Broken', 'InRepair', 'Retired'));
+
+CREATE TABLE IF NOT EXISTS item_status_history (
+    ID INT PRIMARY KEY AUTO_INCREMENT,
+    ItemID INT NOT NULL,
+    FromStatus VARCHAR(50) NOT NULL,
+    ToStatus VARCHAR(50) NOT NULL,
+    Reason VARCHAR(255) NOT NULL,
+    Actor VARCHAR(255) NOT NULL,
+    ChangedAt DATETIME NOT NULL,
+    FOREIGN KEY (ItemID) REFERENCES item(ID) ON DELETE CASCADE
+);
+
+INSERT INTO item_status_history (ItemID, FromStatus, ToStatus, Reason, Actor, ChangedAt)
+SELECT ID, '', Status, 'initial status', 'migration', CURRENT_TIMESTAMP FROM item;
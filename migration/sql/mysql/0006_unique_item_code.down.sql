@@ -0,0 +1 @@
+DROP INDEX item_item_code_key ON item;
@@ -0,0 +1,8 @@
+-- Codes used to be free-form, so several items can share one. The item with
+-- the lowest ID keeps it; the others get their ID appended, e.g. CODE001-7.
+-- Reverting does not restore the old codes.
+UPDATE item
+SET ItemCode = CONCAT(LEFT(ItemCode, 49 - LENGTH(ID)), '-', ID)
+WHERE ID NOT IN (SELECT KeepID FROM (SELECT MIN(ID) AS KeepID FROM item GROUP BY ItemCode) AS keep);
+
+CREATE UNIQUE INDEX item_item_code_key ON item (ItemCode);
@@ -0,0 +1,7 @@
+DELETE FROM item_movement WHERE ItemID NOT IN (SELECT ID FROM item);
+
+ALTER TABLE item_movement ADD CONSTRAINT item_movement_ibfk_1 FOREIGN KEY (ItemID) REFERENCES item(ID) ON DELETE CASCADE;
+
+DELETE FROM item_status_history WHERE ItemID NOT IN (SELECT ID FROM item);
+
+ALTER TABLE item_status_history ADD CONSTRAINT item_status_history_ibfk_1 FOREIGN KEY (ItemID) REFERENCES item(ID) ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+-- The ledger and status history outlive the item they describe, so deleting
+-- an item no longer cascades into them.
+ALTER TABLE item_movement DROP FOREIGN KEY item_movement_ibfk_1;
+
+ALTER TABLE item_status_history DROP FOREIGN KEY item_status_history_ibfk_1;
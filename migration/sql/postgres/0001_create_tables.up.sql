@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS heroes (
+    ID SERIAL PRIMARY KEY,
+    Name VARCHAR(255) NOT NULL,
+    Universe VARCHAR(255) NOT NULL,
+    Skill VARCHAR(255),
+    ImageURL VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS villain (
+    ID SERIAL PRIMARY KEY,
+    Name VARCHAR(255) NOT NULL,
+    Universe VARCHAR(255) NOT NULL,
+    ImageURL VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS crimeevent (
+    ID SERIAL PRIMARY KEY,
+    HeroID INT REFERENCES heroes(ID),
+    VillainID INT REFERENCES villain(ID),
+    Description TEXT,
+    DateTime TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS item (
+    ID SERIAL PRIMARY KEY,
+    Name VARCHAR(255) NOT NULL,
+    ItemCode VARCHAR(50) NOT NULL,
+    Stock INT NOT NULL,
+    Description VARCHAR(255),
+    Status VARCHAR(50) NOT NULL,
+    CONSTRAINT item_status_check CHECK (Status IN ('Active', 'Broken'))
+);
@@ -0,0 +1,7 @@
+ALTER TABLE item DROP COLUMN Version;
+
+ALTER TABLE crimeevent DROP COLUMN Version;
+
+ALTER TABLE villain DROP COLUMN Version;
+
+ALTER TABLE heroes DROP COLUMN Version;
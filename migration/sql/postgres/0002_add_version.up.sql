@@ -0,0 +1,7 @@
+ALTER TABLE heroes ADD COLUMN Version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE villain ADD COLUMN Version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE crimeevent ADD COLUMN Version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE item ADD COLUMN Version INT NOT NULL DEFAULT 1;
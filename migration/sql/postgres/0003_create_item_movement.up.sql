@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS item_movement (
+    ID SERIAL PRIMARY KEY,
+    ItemID INT NOT NULL REFERENCES item(ID) ON DELETE CASCADE,
+    Delta INT NOT NULL,
+    Stock INT NOT NULL,
+    Reason VARCHAR(255) NOT NULL,
+    Actor VARCHAR(255) NOT NULL,
+    CreatedAt TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS item_movement_item_idx ON item_movement (ItemID);
+
+INSERT INTO item_movement (ItemID, Delta, Stock, Reason, Actor, CreatedAt)
+SELECT ID, Stock, Stock, 'opening balance', 'migration', CURRENT_TIMESTAMP FROM item;
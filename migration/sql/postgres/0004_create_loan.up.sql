@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS loan (
+    ID SERIAL PRIMARY KEY,
+    ItemID INT NOT NULL REFERENCES item(ID),
+    HeroID INT NOT NULL REFERENCES heroes(ID),
+    Quantity INT NOT NULL,
+    Status VARCHAR(50) NOT NULL,
+    CheckedOutAt TIMESTAMP NOT NULL,
+    DueAt TIMESTAMP NOT NULL,
+    ReturnedAt TIMESTAMP,
+    CONSTRAINT loan_quantity_check CHECK (Quantity > 0),
+    CONSTRAINT loan_status_check CHECK (Status IN ('Out', 'Returned', 'Broken'))
+);
+
+CREATE INDEX IF NOT EXISTS loan_item_idx ON loan (ItemID);
+
+CREATE INDEX IF NOT EXISTS loan_hero_idx ON loan (HeroID);
+
+CREATE INDEX IF NOT EXISTS loan_status_due_idx ON loan (Status, DueAt);
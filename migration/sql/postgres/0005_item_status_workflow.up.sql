@@ -0,0 +1,18 @@
+ALTER TABLE item DROP CONSTRAINT item_status_check;
+
+ALTER TABLE item ADD CONSTRAINT item_status_check CHECK (Status IN ('Active', 'Broken', 'InRepair', 'Retired'));
+
+CREATE TABLE IF NOT EXISTS item_status_history (
+    ID SERIAL PRIMARY KEY,
+    ItemID INT NOT NULL REFERENCES item(ID) ON DELETE CASCADE,
+    FromStatus VARCHAR(50) NOT NULL,
+    ToStatus VARCHAR(50) NOT NULL,
+    Reason VARCHAR(255) NOT NULL,
+    Actor VARCHAR(255) NOT NULL,
+    ChangedAt TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS item_status_history_item_idx ON item_status_history (ItemID);
+
+INSERT INTO item_status_history (ItemID, FromStatus, ToStatus, Reason, Actor, ChangedAt)
+SELECT ID, '', Status, 'initial status', 'migration', CURRENT_TIMESTAMP FROM item;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS item_item_code_key;
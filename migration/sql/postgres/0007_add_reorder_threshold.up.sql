@@ -0,0 +1 @@
+ALTER TABLE item ADD COLUMN ReorderThreshold INT NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- The ledger and status history outlive the item they describe, so deleting
+-- an item no longer cascades into them.
+ALTER TABLE item_movement DROP CONSTRAINT item_movement_itemid_fkey;
+
+ALTER TABLE item_status_history DROP CONSTRAINT item_status_history_itemid_fkey;
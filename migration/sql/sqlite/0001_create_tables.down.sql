@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS crimeevent;
+
+DROP TABLE IF EXISTS item;
+
+DROP TABLE IF EXISTS villain;
+
+DROP TABLE IF EXISTS heroes;
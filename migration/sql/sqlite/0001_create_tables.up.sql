@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS heroes (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Name TEXT NOT NULL,
+    Universe TEXT NOT NULL,
+    Skill TEXT,
+    ImageURL TEXT
+);
+
+CREATE TABLE IF NOT EXISTS villain (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Name TEXT NOT NULL,
+    Universe TEXT NOT NULL,
+    ImageURL TEXT
+);
+
+CREATE TABLE IF NOT EXISTS crimeevent (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    HeroID INTEGER REFERENCES heroes(ID),
+    VillainID INTEGER REFERENCES villain(ID),
+    Description TEXT,
+    DateTime TEXT
+);
+
+CREATE TABLE IF NOT EXISTS item (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Name TEXT NOT NULL,
+    ItemCode TEXT NOT NULL,
+    Stock INTEGER NOT NULL,
+    Description TEXT,
+    Status TEXT NOT NULL,
+    CONSTRAINT item_status_check CHECK (Status IN ('Active', 'Broken'))
+);
@@ -0,0 +1,7 @@
+ALTER TABLE heroes ADD COLUMN Version INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE villain ADD COLUMN Version INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE crimeevent ADD COLUMN Version INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE item ADD COLUMN Version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS item_movement (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    ItemID INTEGER NOT NULL REFERENCES item(ID) ON DELETE CASCADE,
+    Delta INTEGER NOT NULL,
+    Stock INTEGER NOT NULL,
+    Reason TEXT NOT NULL,
+    Actor TEXT NOT NULL,
+    CreatedAt TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS item_movement_item_idx ON item_movement (ItemID);
+
+INSERT INTO item_movement (ItemID, Delta, Stock, Reason, Actor, CreatedAt)
+SELECT ID, Stock, Stock, 'opening balance', 'migration', CURRENT_TIMESTAMP FROM item;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS loan (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    ItemID INTEGER NOT NULL REFERENCES item(ID),
+    HeroID INTEGER NOT NULL REFERENCES heroes(ID),
+    Quantity INTEGER NOT NULL,
+    Status TEXT NOT NULL,
+    CheckedOutAt TEXT NOT NULL,
+    DueAt TEXT NOT NULL,
+    ReturnedAt TEXT,
+    CONSTRAINT loan_quantity_check CHECK (Quantity > 0),
+    CONSTRAINT loan_status_check CHECK (Status IN ('Out', 'Returned', 'Broken'))
+);
+
+CREATE INDEX IF NOT EXISTS loan_item_idx ON loan (ItemID);
+
+CREATE INDEX IF NOT EXISTS loan_hero_idx ON loan (HeroID);
+
+CREATE INDEX IF NOT EXISTS loan_status_due_idx ON loan (Status, DueAt);
@@ -0,0 +1,23 @@
+DROP TABLE IF EXISTS item_status_history;
+
+-- The old constraint only knows Active and Broken; items in repair or retired
+-- count as broken.
+CREATE TABLE item_old (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Name TEXT NOT NULL,
+    ItemCode TEXT NOT NULL,
+    Stock INTEGER NOT NULL,
+    Description TEXT,
+    Status TEXT NOT NULL,
+    Version INTEGER NOT NULL DEFAULT 1,
+    CONSTRAINT item_status_check CHECK (Status IN ('Active', 'Broken'))
+);
+
+INSERT INTO item_old (ID, Name, ItemCode, Stock, Description, Status, Version)
+SELECT ID, Name, ItemCode, Stock, Description,
+    CASE WHEN Status IN ('InRepair', 'Retired') THEN 'Broken' ELSE Status END, Version
+FROM item;
+
+DROP TABLE item;
+
+ALTER TABLE item_old RENAME TO item;
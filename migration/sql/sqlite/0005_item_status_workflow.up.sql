@@ -0,0 +1,34 @@
+-- SQLite cannot alter a CHECK constraint, so item is rebuilt. Foreign keys
+-- are off while migrations run; see migration.go.
+CREATE TABLE item_new (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Name TEXT NOT NULL,
+    ItemCode TEXT NOT NULL,
+    Stock INTEGER NOT NULL,
+    Description TEXT,
+    Status TEXT NOT NULL,
+    Version INTEGER NOT NULL DEFAULT 1,
+    CONSTRAINT item_status_check CHECK (Status IN ('Active', 'Broken', 'InRepair', 'Retired'))
+);
+
+INSERT INTO item_new (ID, Name, ItemCode, Stock, Description, Status, Version)
+SELECT ID, Name, ItemCode, Stock, Description, Status, Version FROM item;
+
+DROP TABLE item;
+
+ALTER TABLE item_new RENAME TO item;
+
+CREATE TABLE IF NOT EXISTS item_status_history (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    ItemID INTEGER NOT NULL REFERENCES item(ID) ON DELETE CASCADE,
+    FromStatus TEXT NOT NULL,
+    ToStatus TEXT NOT NULL,
+    Reason TEXT NOT NULL,
+    Actor TEXT NOT NULL,
+    ChangedAt TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS item_status_history_item_idx ON item_status_history (ItemID);
+
+INSERT INTO item_status_history (ItemID, FromStatus, ToStatus, Reason, Actor, ChangedAt)
+SELECT ID, '', Status, 'initial status', 'migration', CURRENT_TIMESTAMP FROM item;
@@ -0,0 +1,8 @@
+-- Codes used to be free-form, so several items can share one. The item with
+-- the lowest ID keeps it; the others get their ID appended, e.g. CODE001-7.
+-- Reverting does not restore the old codes.
+UPDATE item
+SET ItemCode = substr(ItemCode, 1, 49 - length(ID)) || '-' || ID
+WHERE ID NOT IN (SELECT MIN(ID) FROM item GROUP BY ItemCode);
+
+CREATE UNIQUE INDEX item_item_code_key ON item (ItemCode);
@@ -0,0 +1,39 @@
+CREATE TABLE item_movement_old (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    ItemID INTEGER NOT NULL REFERENCES item(ID) ON DELETE CASCADE,
+    Delta INTEGER NOT NULL,
+    Stock INTEGER NOT NULL,
+    Reason TEXT NOT NULL,
+    Actor TEXT NOT NULL,
+    CreatedAt TEXT NOT NULL
+);
+
+INSERT INTO item_movement_old (ID, ItemID, Delta, Stock, Reason, Actor, CreatedAt)
+SELECT ID, ItemID, Delta, Stock, Reason, Actor, CreatedAt FROM item_movement
+WHERE ItemID IN (SELECT ID FROM item);
+
+DROP TABLE item_movement;
+
+ALTER TABLE item_movement_old RENAME TO item_movement;
+
+CREATE INDEX IF NOT EXISTS item_movement_item_idx ON item_movement (ItemID);
+
+CREATE TABLE item_status_history_old (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    ItemID INTEGER NOT NULL REFERENCES item(ID) ON DELETE CASCADE,
+    FromStatus TEXT NOT NULL,
+    ToStatus TEXT NOT NULL,
+    Reason TEXT NOT NULL,
+    Actor TEXT NOT NULL,
+    ChangedAt TEXT NOT NULL
+);
+
+INSERT INTO item_status_history_old (ID, ItemID, FromStatus, ToStatus, Reason, Actor, ChangedAt)
+SELECT ID, ItemID, FromStatus, ToStatus, Reason, Actor, ChangedAt FROM item_status_history
+WHERE ItemID IN (SELECT ID FROM item);
+
+DROP TABLE item_status_history;
+
+ALTER TABLE item_status_history_old RENAME TO item_status_history;
+
+CREATE INDEX IF NOT EXISTS item_status_history_item_idx ON item_status_history (ItemID);
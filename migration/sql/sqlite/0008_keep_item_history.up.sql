@@ -0,0 +1,40 @@
+-- The ledger and status history outlive the item they describe, so deleting
+-- an item no longer cascades into them. SQLite cannot drop a foreign key, so
+-- both tables are rebuilt without one.
+CREATE TABLE item_movement_new (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    ItemID INTEGER NOT NULL,
+    Delta INTEGER NOT NULL,
+    Stock INTEGER NOT NULL,
+    Reason TEXT NOT NULL,
+    Actor TEXT NOT NULL,
+    CreatedAt TEXT NOT NULL
+);
+
+INSERT INTO item_movement_new (ID, ItemID, Delta, Stock, Reason, Actor, CreatedAt)
+SELECT ID, ItemID, Delta, Stock, Reason, Actor, CreatedAt FROM item_movement;
+
+DROP TABLE item_movement;
+
+ALTER TABLE item_movement_new RENAME TO item_movement;
+
+CREATE INDEX IF NOT EXISTS item_movement_item_idx ON item_movement (ItemID);
+
+CREATE TABLE item_status_history_new (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    ItemID INTEGER NOT NULL,
+    FromStatus TEXT NOT NULL,
+    ToStatus TEXT NOT NULL,
+    Reason TEXT NOT NULL,
+    Actor TEXT NOT NULL,
+    ChangedAt TEXT NOT NULL
+);
+
+INSERT INTO item_status_history_new (ID, ItemID, FromStatus, ToStatus, Reason, Actor, ChangedAt)
+SELECT ID, ItemID, FromStatus, ToStatus, Reason, Actor, ChangedAt FROM item_status_history;
+
+DROP TABLE item_status_history;
+
+ALTER TABLE item_status_history_new RENAME TO item_status_history;
+
+CREATE INDEX IF NOT EXISTS item_status_history_item_idx ON item_status_history (ItemID);
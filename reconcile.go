@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"ngc4/repository"
+	"os"
+)
+
+// reconcile implements "ngc4 reconcile": it checks that the stock of every
+// item equals the sum of its movements and exits with status 1 when one does
+// not.
+func reconcile() {
+	if cfg.Storage == "memory" {
+		log.Fatal("reconcile needs a SQL backend; the memory store is empty on every start")
+	}
+
+	db, dialect, err := openDB()
+	if err != nil {
+		log.Fatal("Failed connecting to Database: ", err)
+	}
+	defer db.Close()
+
+	store := repository.NewSQLStore(db, dialect, itemCodes())
+	discrepancies, err := store.Items.Reconcile(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(discrepancies) == 0 {
+		fmt.Println("stock matches the movement ledger")
+		return
+	}
+	for _, d := range discrepancies {
+		fmt.Printf("item %d: stock %d, ledger %d\n", d.ItemID, d.Stock, d.Ledger)
+	}
+	db.Close()
+	os.Exit(1)
+}
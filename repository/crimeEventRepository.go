@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"ngc4/entity"
+)
+
+type sqlCrimeEventRepository struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func (r *sqlCrimeEventRepository) FindAll(ctx context.Context) ([]entity.CrimeEvent, error) {
+	return r.selectRows(ctx, ListQuery{})
+}
+
+func (r *sqlCrimeEventRepository) List(ctx context.Context, q ListQuery) ([]entity.CrimeEvent, int, error) {
+	total, err := r.dialect.count(ctx, r.db, "crimeevent", q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	crimeEvent, err := r.selectRows(ctx, q)
+	return crimeEvent, total, err
+}
+
+func (r *sqlCrimeEventRepository) selectRows(ctx context.Context, q ListQuery) ([]entity.CrimeEvent, error) {
+	var crimeEvent []entity.CrimeEvent
+
+	where, args := q.where("crimeevent", false)
+	query := `SELECT ID, Version, HeroID, VillainID, Description, ` + r.dialect.dateTime("DateTime") + ` FROM crimeevent` + where + q.tail("crimeevent")
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ce := entity.CrimeEvent{}
+		err := rows.Scan(&ce.ID, &ce.Version, &ce.HeroID, &ce.VillainID, &ce.Description, &ce.DateTime)
+		if err != nil {
+			return nil, err
+		}
+		crimeEvent = append(crimeEvent, ce)
+	}
+	return crimeEvent, rows.Err()
+}
+
+func (r *sqlCrimeEventRepository) FindByID(ctx context.Context, id int) (entity.CrimeEvent, error) {
+	var crimeEvent entity.CrimeEvent
+
+	query := `
+		SELECT ID, Version, HeroID, VillainID, Description, ` + r.dialect.dateTime("DateTime") + ` FROM crimeevent
+		WHERE ID = ?
+	`
+
+	row := r.db.QueryRowContext(ctx, r.dialect.Rebind(query), id)
+	err := row.Scan(&crimeEvent.ID, &crimeEvent.Version, &crimeEvent.HeroID, &crimeEvent.VillainID, &crimeEvent.Description, &crimeEvent.DateTime)
+	if err == sql.ErrNoRows {
+		return crimeEvent, ErrNotFound
+	}
+	return crimeEvent, err
+}
+
+func (r *sqlCrimeEventRepository) ListWithRelations(ctx context.Context, q ListQuery) ([]entity.CrimeEventDetail, int, error) {
+	total, err := r.dialect.count(ctx, r.db, "crimeevent", q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where, args := q.where("crimeevent", false)
+	crimeEvent, err := r.selectDetails(ctx, where+q.tail("crimeevent"), args...)
+	return crimeEvent, total, err
+}
+
+func (r *sqlCrimeEventRepository) FindByIDWithRelations(ctx context.Context, id int) (entity.CrimeEventDetail, error) {
+	crimeEvent, err := r.selectDetails(ctx, " WHERE crimeevent.ID = ?", id)
+	if err != nil {
+		return entity.CrimeEventDetail{}, err
+	}
+	if len(crimeEvent) == 0 {
+		return entity.CrimeEventDetail{}, ErrNotFound
+	}
+	return crimeEvent[0], nil
+}
+
+// selectDetails joins crimeevent with the heroes and villain rows it
+// references. The foreign keys guarantee both exist.
+func (r *sqlCrimeEventRepository) selectDetails(ctx context.Context, clause string, args ...any) ([]entity.CrimeEventDetail, error) {
+	var crimeEvent []entity.CrimeEventDetail
+
+	query := `
+		SELECT crimeevent.ID, crimeevent.Version, crimeevent.HeroID, crimeevent.VillainID, crimeevent.Description, ` + r.dialect.dateTime("DateTime") + `,
+			heroes.ID, heroes.Version, heroes.Name, heroes.Universe, heroes.Skill, heroes.ImageURL,
+			villain.ID, villain.Version, villain.Name, villain.Universe, villain.ImageURL
+		FROM crimeevent
+		JOIN heroes ON heroes.ID = crimeevent.HeroID
+		JOIN villain ON villain.ID = crimeevent.VillainID
+	` + clause
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ce := entity.CrimeEventDetail{Hero: &entity.Heroes{}, Villain: &entity.Villain{}}
+		err := rows.Scan(&ce.ID, &ce.Version, &ce.HeroID, &ce.VillainID, &ce.Description, &ce.DateTime,
+			&ce.Hero.ID, &ce.Hero.Version, &ce.Hero.Name, &ce.Hero.Universe, &ce.Hero.Skill, &ce.Hero.ImageURL,
+			&ce.Villain.ID, &ce.Villain.Version, &ce.Villain.Name, &ce.Villain.Universe, &ce.Villain.ImageURL)
+		if err != nil {
+			return nil, err
+		}
+		crimeEvent = append(crimeEvent, ce)
+	}
+	return crimeEvent, rows.Err()
+}
+
+func (r *sqlCrimeEventRepository) Create(ctx context.Context, crimeEvent *entity.CrimeEvent) error {
+	id, err := r.dialect.insertRow(ctx, r.db, "crimeevent", crimeEvent.ID,
+		[]string{"HeroID", "VillainID", "Description", "DateTime"},
+		crimeEvent.HeroID, crimeEvent.VillainID, crimeEvent.Description, crimeEvent.DateTime)
+	if err != nil {
+		return err
+	}
+
+	crimeEvent.ID = id
+	crimeEvent.Version = 1
+	return nil
+}
+
+func (r *sqlCrimeEventRepository) Update(ctx context.Context, crimeEvent entity.CrimeEvent) error {
+	query := `
+        UPDATE crimeevent
+        SET HeroID = ?, VillainID = ?, Description = ?, DateTime = ?, Version = Version + 1
+        WHERE ID = ? AND Version = ?
+    `
+	return r.dialect.execVersioned(ctx, r.db, "crimeevent", crimeEvent.ID, query, crimeEvent.HeroID, crimeEvent.VillainID, crimeEvent.Description, crimeEvent.DateTime, crimeEvent.ID, crimeEvent.Version)
+}
+
+func (r *sqlCrimeEventRepository) Delete(ctx context.Context, id, version int) error {
+	query := `
+        DELETE FROM crimeevent
+        WHERE ID = ? AND Version = ?
+    `
+	return r.dialect.execVersioned(ctx, r.db, "crimeevent", id, query, id, version)
+}
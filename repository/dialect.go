@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Dialect captures what differs between the SQL databases the repositories
+// can run on.
+type Dialect struct {
+	Name   string
+	Driver string
+
+	// numbered placeholders are written $1, $2, ... instead of ?.
+	numbered bool
+	// returning drivers have no LastInsertId, so inserts read the new key
+	// back with INSERT ... RETURNING ID.
+	returning bool
+	// dateTimeFormat wraps a DATETIME column, as %s, into the select
+	// expression that returns it as "YYYY-MM-DD HH:MM:SS".
+	dateTimeFormat string
+}
+
+var MySQL = Dialect{
+	Name:           "mysql",
+	Driver:         "mysql",
+	dateTimeFormat: "%s",
+}
+
+// SQLite keeps DateTime in a TEXT column (see migration/sql/sqlite) so the
+// driver hands back the string that was written instead of a time.Time.
+var SQLite = Dialect{
+	Name:           "sqlite",
+	Driver:         "sqlite3",
+	dateTimeFormat: "%s",
+}
+
+// Postgres has no LastInsertId and numbers its placeholders. DateTime is a
+// TIMESTAMP, formatted back to the MySQL layout on the way out.
+var Postgres = Dialect{
+	Name:           "postgres",
+	Driver:         "postgres",
+	numbered:       true,
+	returning:      true,
+	dateTimeFormat: "to_char(%s, 'YYYY-MM-DD HH24:MI:SS')",
+}
+
+// DialectFor looks a dialect up by name, e.g. "mysql" or "sqlite".
+func DialectFor(name string) (Dialect, error) {
+	for _, d := range []Dialect{MySQL, SQLite, Postgres} {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return Dialect{}, fmt.Errorf("unknown SQL dialect %q", name)
+}
+
+// dateTime is the select expression for the DATETIME column, e.g.
+// crimeevent.DateTime, in the layout every dialect returns.
+func (d Dialect) dateTime(column string) string {
+	return fmt.Sprintf(d.dateTimeFormat, column)
+}
+
+// Rebind rewrites the "?" placeholders used in the repository queries into
+// the form the dialect expects.
+func (d Dialect) Rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// insert runs an INSERT statement and returns the ID generated for the row.
+func (d Dialect) insert(ctx context.Context, db dbtx, query string, args ...any) (int64, error) {
+	if d.returning {
+		var id int64
+		err := db.QueryRowContext(ctx, d.Rebind(query)+" RETURNING ID", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := db.ExecContext(ctx, d.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// insertRow inserts one row and returns its ID. A non-zero id is stored as
+// the primary key, zero lets the database generate one.
+func (d Dialect) insertRow(ctx context.Context, db dbtx, table string, id int, columns []string, values ...any) (int, error) {
+	if id != 0 {
+		columns = append([]string{"ID"}, columns...)
+		values = append([]any{id}, values...)
+	}
+
+	query := `INSERT INTO ` + table + ` (` + strings.Join(columns, ", ") + `)
+		VALUES (?` + strings.Repeat(", ?", len(columns)-1) + `)`
+
+	newID, err := d.insert(ctx, db, query, values...)
+	if err != nil {
+		return 0, translate(err)
+	}
+	if id != 0 {
+		return id, d.syncSequence(ctx, db, table)
+	}
+	return int(newID), nil
+}
+
+// execVersioned runs an UPDATE or DELETE of the row id in table that is
+// guarded by "Version = ?". When it touches nothing, a row that is gone is
+// not an error and one whose version has moved on is ErrStale.
+func (d Dialect) execVersioned(ctx context.Context, db dbtx, table string, id int, query string, args ...any) error {
+	result, err := db.ExecContext(ctx, d.Rebind(query), args...)
+	if err != nil {
+		return translate(err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	var rows int
+	if err := db.QueryRowContext(ctx, d.Rebind(`SELECT COUNT(*) FROM `+table+` WHERE ID = ?`), id).Scan(&rows); err != nil {
+		return err
+	}
+	if rows > 0 {
+		return fmt.Errorf("%w: %s %d", ErrStale, table, id)
+	}
+	return nil
+}
+
+// syncSequence moves the key generator of table past the highest stored ID.
+// It is needed after inserting an explicit ID on dialects whose sequences do
+// not notice that on their own.
+func (d Dialect) syncSequence(ctx context.Context, db dbtx, table string) error {
+	if d.Name != Postgres.Name {
+		return nil
+	}
+
+	query := `SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE(MAX(ID), 1)) FROM ` + table
+	_, err := db.ExecContext(ctx, query, table)
+	return err
+}
+
+// NewSQLStore returns repositories backed by db, speaking the given dialect.
+// Items created without an ItemCode get one from codes.
+func NewSQLStore(db *sql.DB, d Dialect, codes ItemCodes) Store {
+	items := &sqlItemRepository{db: db, dialect: d, codes: codes}
+	return Store{
+		Heroes:      &sqlHeroRepository{db: db, dialect: d},
+		Villains:    &sqlVillainRepository{db: db, dialect: d},
+		CrimeEvents: &sqlCrimeEventRepository{db: db, dialect: d},
+		Items:       items,
+		Loans:       &sqlLoanRepository{db: db, dialect: d, items: items},
+	}
+}
+
+// translate wraps driver errors for NOT NULL and CHECK violations in
+// ErrInvalid and those for unique and foreign key violations in
+// ErrConstraint, so callers treat every backend alike.
+func translate(err error) error {
+	var mysqlErr *mysql.MySQLError
+	var sqliteErr sqlite3.Error
+	var pqErr *pq.Error
+
+	switch {
+	case errors.As(err, &mysqlErr):
+		switch mysqlErr.Number {
+		case 1048, 3819:
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		case 1062, 1216, 1217, 1451, 1452:
+			return fmt.Errorf("%w: %v", ErrConstraint, err)
+		}
+	case errors.As(err, &sqliteErr):
+		switch {
+		case sqliteErr.ExtendedCode == sqlite3.ErrConstraintNotNull, sqliteErr.ExtendedCode == sqlite3.ErrConstraintCheck:
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		case sqliteErr.Code == sqlite3.ErrConstraint:
+			return fmt.Errorf("%w: %v", ErrConstraint, err)
+		}
+	case errors.As(err, &pqErr):
+		switch pqErr.Code {
+		case "23502", "23514":
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		// The rest of class 23 is "integrity constraint violation".
+		if pqErr.Code.Class() == "23" {
+			return fmt.Errorf("%w: %v", ErrConstraint, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"ngc4/entity"
+)
+
+type sqlHeroRepository struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func (r *sqlHeroRepository) FindAll(ctx context.Context) ([]entity.Heroes, error) {
+	return r.selectRows(ctx, ListQuery{})
+}
+
+func (r *sqlHeroRepository) List(ctx context.Context, q ListQuery) ([]entity.Heroes, int, error) {
+	total, err := r.dialect.count(ctx, r.db, "heroes", q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hero, err := r.selectRows(ctx, q)
+	return hero, total, err
+}
+
+func (r *sqlHeroRepository) selectRows(ctx context.Context, q ListQuery) ([]entity.Heroes, error) {
+	var hero []entity.Heroes
+
+	where, args := q.where("heroes", false)
+	query := `SELECT ID, Version, Name, Universe, Skill, ImageURL FROM heroes` + where + q.tail("heroes")
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		h := entity.Heroes{}
+		err := rows.Scan(&h.ID, &h.Version, &h.Name, &h.Universe, &h.Skill, &h.ImageURL)
+		if err != nil {
+			return nil, err
+		}
+		hero = append(hero, h)
+	}
+	return hero, rows.Err()
+}
+
+func (r *sqlHeroRepository) FindByID(ctx context.Context, id int) (entity.Heroes, error) {
+	var hero entity.Heroes
+
+	query := `
+		SELECT ID, Version, Name, Universe, Skill, ImageURL FROM heroes
+		WHERE ID = ?
+	`
+
+	row := r.db.QueryRowContext(ctx, r.dialect.Rebind(query), id)
+	err := row.Scan(&hero.ID, &hero.Version, &hero.Name, &hero.Universe, &hero.Skill, &hero.ImageURL)
+	if err == sql.ErrNoRows {
+		return hero, ErrNotFound
+	}
+	return hero, err
+}
+
+func (r *sqlHeroRepository) Create(ctx context.Context, hero *entity.Heroes) error {
+	id, err := r.dialect.insertRow(ctx, r.db, "heroes", hero.ID,
+		[]string{"Name", "Universe", "Skill", "ImageURL"},
+		hero.Name, hero.Universe, hero.Skill, hero.ImageURL)
+	if err != nil {
+		return err
+	}
+
+	hero.ID = id
+	hero.Version = 1
+	return nil
+}
+
+func (r *sqlHeroRepository) Update(ctx context.Context, hero entity.Heroes) error {
+	query := `
+        UPDATE heroes
+        SET Name = ?, Universe = ?, Skill = ?, ImageURL = ?, Version = Version + 1
+        WHERE ID = ? AND Version = ?
+    `
+	return r.dialect.execVersioned(ctx, r.db, "heroes", hero.ID, query, hero.Name, hero.Universe, hero.Skill, hero.ImageURL, hero.ID, hero.Version)
+}
+
+func (r *sqlHeroRepository) Delete(ctx context.Context, id, version int) error {
+	query := `
+        DELETE FROM heroes
+        WHERE ID = ? AND Version = ?
+    `
+	return r.dialect.execVersioned(ctx, r.db, "heroes", id, query, id, version)
+}
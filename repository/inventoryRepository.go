@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ngc4/entity"
+)
+
+type sqlItemRepository struct {
+	db      *sql.DB
+	dialect Dialect
+	codes   ItemCodes
+}
+
+func (r *sqlItemRepository) FindAll(ctx context.Context) ([]entity.Item, error) {
+	return r.selectRows(ctx, ListQuery{})
+}
+
+func (r *sqlItemRepository) List(ctx context.Context, q ListQuery) ([]entity.Item, int, error) {
+	total, err := r.dialect.count(ctx, r.db, "item", q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	item, err := r.selectRows(ctx, q)
+	return item, total, err
+}
+
+func (r *sqlItemRepository) selectRows(ctx context.Context, q ListQuery) ([]entity.Item, error) {
+	var item []entity.Item
+
+	where, args := q.where("item", false)
+	query := `SELECT ID, Version, Name, ItemCode, Stock, ReorderThreshold, Description, Status FROM item` + where + q.tail("item")
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i := entity.Item{}
+		err := rows.Scan(&i.ID, &i.Version, &i.Name, &i.ItemCode, &i.Stock, &i.ReorderThreshold, &i.Description, &i.Status)
+		if err != nil {
+			return nil, err
+		}
+		item = append(item, i)
+	}
+	return item, rows.Err()
+}
+
+func (r *sqlItemRepository) FindByID(ctx context.Context, id int) (entity.Item, error) {
+	return r.findByID(ctx, r.db, id)
+}
+
+func (r *sqlItemRepository) FindByCode(ctx context.Context, code string) (entity.Item, error) {
+	var item entity.Item
+	query := `
+        SELECT ID, Version, Name, ItemCode, Stock, ReorderThreshold, Description, Status
+        FROM item
+        WHERE ItemCode = ?
+    `
+	row := r.db.QueryRowContext(ctx, r.dialect.Rebind(query), code)
+	err := row.Scan(&item.ID, &item.Version, &item.Name, &item.ItemCode, &item.Stock, &item.ReorderThreshold, &item.Description, &item.Status)
+	if err == sql.ErrNoRows {
+		return item, ErrNotFound
+	}
+	return item, err
+}
+
+func (r *sqlItemRepository) findByID(ctx context.Context, db dbtx, id int) (entity.Item, error) {
+	var item entity.Item
+	query := `
+        SELECT ID, Version, Name, ItemCode, Stock, ReorderThreshold, Description, Status
+        FROM item
+        WHERE ID = ?
+    `
+	row := db.QueryRowContext(ctx, r.dialect.Rebind(query), id)
+	err := row.Scan(&item.ID, &item.Version, &item.Name, &item.ItemCode, &item.Stock, &item.ReorderThreshold, &item.Description, &item.Status)
+	if err == sql.ErrNoRows {
+		return item, ErrNotFound
+	}
+	return item, err
+}
+
+// Create generates an ItemCode when item has none. Two creates may pick the
+// same code at once; the unique index lets one through and the other tries
+// again with the next number.
+func (r *sqlItemRepository) Create(ctx context.Context, item *entity.Item) error {
+	generate := item.ItemCode == ""
+	for attempt := 1; ; attempt++ {
+		err := r.create(ctx, item, generate)
+		if generate && errors.Is(err, ErrConstraint) && attempt < 5 {
+			continue
+		}
+		return err
+	}
+}
+
+func (r *sqlItemRepository) create(ctx context.Context, item *entity.Item, generate bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	created := *item
+	if generate {
+		if created.ItemCode, err = r.nextCode(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	created.ID, err = r.dialect.insertRow(ctx, tx, "item", item.ID,
+		[]string{"Name", "ItemCode", "Stock", "ReorderThreshold", "Description", "Status"},
+		created.Name, created.ItemCode, created.Stock, created.ReorderThreshold, created.Description, created.Status)
+	if err != nil {
+		return err
+	}
+	if err := r.dialect.recordMovement(ctx, tx, newMovement(ctx, created, created.Stock, ReasonCreated)); err != nil {
+		return err
+	}
+	if err := r.dialect.recordStatusChange(ctx, tx, newStatusChange(ctx, created.ID, "", created.Status, ReasonCreated)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	created.Version = 1
+	*item = created
+	return nil
+}
+
+// nextCode returns the code after the highest generated one in the table.
+func (r *sqlItemRepository) nextCode(ctx context.Context, tx dbtx) (string, error) {
+	rows, err := tx.QueryContext(ctx, r.dialect.Rebind(`SELECT ItemCode FROM item WHERE ItemCode LIKE ?`), r.codes.Prefix+"%")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return "", err
+		}
+		codes = append(codes, code)
+	}
+	return r.codes.next(codes), rows.Err()
+}
+
+// Update reads the stored row in its transaction to know the stock delta and
+// status change to record. The Version guard makes sure that is the row it
+// overwrites.
+func (r *sqlItemRepository) Update(ctx context.Context, item entity.Item) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stored, err := r.findByID(ctx, tx, item.ID)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE item
+        SET Name = ?, ItemCode = ?, Stock = ?, ReorderThreshold = ?, Description = ?, Status = ?, Version = Version + 1
+        WHERE ID = ? AND Version = ?
+    `
+	err = r.dialect.execVersioned(ctx, tx, "item", item.ID, query, item.Name, item.ItemCode, item.Stock, item.ReorderThreshold,
+		item.Description, item.Status, item.ID, item.Version)
+	if err != nil {
+		return err
+	}
+	if delta := item.Stock - stored.Stock; delta != 0 {
+		if err := r.dialect.recordMovement(ctx, tx, newMovement(ctx, item, delta, ReasonUpdated)); err != nil {
+			return err
+		}
+	}
+	if item.Status != stored.Status {
+		if err := r.dialect.recordStatusChange(ctx, tx, newStatusChange(ctx, item.ID, stored.Status, item.Status, ReasonUpdated)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete keeps the movements of the item and closes its ledger with one
+// taking the remaining stock out, so the history shows who deleted it.
+func (r *sqlItemRepository) Delete(ctx context.Context, id, version int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stored, err := r.findByID(ctx, tx, id)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `
+        DELETE FROM item
+        WHERE ID = ? AND Version = ?
+    `
+	if err := r.dialect.execVersioned(ctx, tx, "item", id, query, id, version); err != nil {
+		return err
+	}
+	closed := stored
+	closed.Stock = 0
+	if err := r.dialect.recordMovement(ctx, tx, newMovement(ctx, closed, -stored.Stock, ReasonDeleted)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdjustStock changes Stock in one conditional UPDATE, so concurrent
+// adjustments cannot race each other below zero. The row is read back and the
+// movement recorded in the same transaction.
+func (r *sqlItemRepository) AdjustStock(ctx context.Context, id, delta int, reason string) (entity.Item, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Item{}, err
+	}
+	defer tx.Rollback()
+
+	item, err := r.adjust(ctx, tx, id, delta, reason, "")
+	if err != nil {
+		return item, err
+	}
+	return item, tx.Commit()
+}
+
+// adjust is AdjustStock within the transaction tx, which the caller commits.
+// A non-empty status is one more condition of the UPDATE: the item must be in
+// it, or adjust fails with ErrUnavailable.
+func (r *sqlItemRepository) adjust(ctx context.Context, tx dbtx, id, delta int, reason, status string) (entity.Item, error) {
+	query := `
+        UPDATE item
+        SET Stock = Stock + ?, Version = Version + 1
+        WHERE ID = ? AND Stock + ? >= 0
+    `
+	args := []any{delta, id, delta}
+	if status != "" {
+		query += ` AND Status = ?`
+		args = append(args, status)
+	}
+	result, err := tx.ExecContext(ctx, r.dialect.Rebind(query), args...)
+	if err != nil {
+		return entity.Item{}, translate(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return entity.Item{}, err
+	}
+
+	item, err := r.findByID(ctx, tx, id)
+	if err != nil {
+		return entity.Item{}, err
+	}
+	if n == 0 && status != "" && item.Status != status {
+		return item, fmt.Errorf("%w: item %d is %s, not %s", ErrUnavailable, id, item.Status, status)
+	}
+	if n == 0 {
+		return item, fmt.Errorf("%w: item %d has %d in stock, cannot apply %d", ErrInsufficientStock, id, item.Stock, delta)
+	}
+	if err := r.dialect.recordMovement(ctx, tx, newMovement(ctx, item, delta, reason)); err != nil {
+		return entity.Item{}, err
+	}
+	return item, nil
+}
+
+// Transition checks the status the item has at version. The Version guard of
+// the UPDATE fails a change made since with ErrStale.
+func (r *sqlItemRepository) Transition(ctx context.Context, id, version int, to, reason string) (entity.Item, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Item{}, err
+	}
+	defer tx.Rollback()
+
+	item, err := r.findByID(ctx, tx, id)
+	if err != nil {
+		return item, err
+	}
+	if item.Version != version {
+		return item, stale("item", id)
+	}
+	if !entity.ItemCanTransition(item.Status, to) {
+		return item, fmt.Errorf("%w: item %d cannot go from %s to %s", ErrTransition, id, item.Status, to)
+	}
+
+	query := `
+        UPDATE item
+        SET Status = ?, Version = Version + 1
+        WHERE ID = ? AND Version = ?
+    `
+	if err := r.dialect.execVersioned(ctx, tx, "item", id, query, to, id, version); err != nil {
+		return item, err
+	}
+	if err := r.dialect.recordStatusChange(ctx, tx, newStatusChange(ctx, id, item.Status, to, reason)); err != nil {
+		return item, err
+	}
+	if err := tx.Commit(); err != nil {
+		return item, err
+	}
+
+	item.Status = to
+	item.Version++
+	return item, nil
+}
+
+func (r *sqlItemRepository) ListMovements(ctx context.Context, id int, q ListQuery) ([]entity.Movement, int, error) {
+	q.Filters = append([]Filter{{Column: "ItemID", Op: "=", Value: id}}, q.Filters...)
+
+	total, err := r.dialect.count(ctx, r.db, "item_movement", q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where, args := q.where("item_movement", false)
+	query := `SELECT ID, ItemID, Delta, Stock, Reason, Actor, ` + r.dialect.dateTime("CreatedAt") + ` FROM item_movement` + where + q.tail("item_movement")
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var movements []entity.Movement
+	for rows.Next() {
+		m := entity.Movement{}
+		if err := rows.Scan(&m.ID, &m.ItemID, &m.Delta, &m.Stock, &m.Reason, &m.Actor, &m.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, total, rows.Err()
+}
+
+func (r *sqlItemRepository) ListStatusHistory(ctx context.Context, id int, q ListQuery) ([]entity.StatusChange, int, error) {
+	q.Filters = append([]Filter{{Column: "ItemID", Op: "=", Value: id}}, q.Filters...)
+
+	total, err := r.dialect.count(ctx, r.db, "item_status_history", q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where, args := q.where("item_status_history", false)
+	query := `SELECT ID, ItemID, FromStatus, ToStatus, Reason, Actor, ` + r.dialect.dateTime("ChangedAt") +
+		` FROM item_status_history` + where + q.tail("item_status_history")
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var changes []entity.StatusChange
+	for rows.Next() {
+		c := entity.StatusChange{}
+		if err := rows.Scan(&c.ID, &c.ItemID, &c.FromStatus, &c.ToStatus, &c.Reason, &c.Actor, &c.ChangedAt); err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, total, rows.Err()
+}
+
+func (r *sqlItemRepository) Reconcile(ctx context.Context) ([]StockDiscrepancy, error) {
+	query := `
+        SELECT item.ID, item.Stock, COALESCE(SUM(item_movement.Delta), 0)
+        FROM item
+        LEFT JOIN item_movement ON item_movement.ItemID = item.ID
+        GROUP BY item.ID, item.Stock
+        HAVING item.Stock <> COALESCE(SUM(item_movement.Delta), 0)
+        ORDER BY item.ID
+    `
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discrepancies []StockDiscrepancy
+	for rows.Next() {
+		var d StockDiscrepancy
+		if err := rows.Scan(&d.ItemID, &d.Stock, &d.Ledger); err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies, rows.Err()
+}
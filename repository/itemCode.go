@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ItemCodes generates the ItemCode of items created without one: Prefix
+// followed by the next sequence number, zero-padded to Width digits.
+type ItemCodes struct {
+	Prefix string
+	Width  int
+}
+
+// DefaultItemCodes continues the codes of the demo fixtures: CODE001,
+// CODE002 and so on.
+var DefaultItemCodes = ItemCodes{Prefix: "CODE", Width: 3}
+
+// next returns the code after the highest one in codes that has the form
+// Prefix followed by digits. Codes of other forms are ignored.
+func (c ItemCodes) next(codes []string) string {
+	highest := 0
+	for _, code := range codes {
+		digits, ok := strings.CutPrefix(code, c.Prefix)
+		if !ok || digits == "" || strings.Trim(digits, "0123456789") != "" {
+			continue
+		}
+		if n, err := strconv.Atoi(digits); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return fmt.Sprintf("%s%0*d", c.Prefix, c.Width, highest+1)
+}
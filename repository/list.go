@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter keeps the rows whose Column compares to Value with Op, one of "=",
+// "<", "<=", ">" and ">=".
+type Filter struct {
+	Column string
+	Op     string
+	// Value is a constant, or a Ref to compare with another column of the
+	// same row.
+	Value any
+}
+
+// Ref names a column as a Filter value, e.g. Stock < Ref("ReorderThreshold").
+// Like Filter.Column it is written into the SQL as it is.
+type Ref string
+
+// SortKey orders rows by Column, descending when Desc is set.
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// ListQuery selects one page of a table.
+//
+// Column names are written into the SQL as they are, so they must come from
+// a whitelist and never straight from a request. They equal the field names
+// of the entity types.
+type ListQuery struct {
+	Filters []Filter
+	Sort    []SortKey
+	// Limit is the maximum number of rows returned; zero means all of them.
+	Limit int
+	// Offset skips that many rows of the ordered result.
+	Offset int
+	// After is a keyset cursor: the Keys values of the last row of the
+	// previous page. Only rows ordered after it are returned.
+	After []any
+}
+
+// Keys is the order rows are listed in: Sort, then ID to break ties, so that
+// every row has a unique position a cursor can point at.
+func (q ListQuery) Keys() []SortKey {
+	for _, key := range q.Sort {
+		if key.Column == "ID" {
+			return q.Sort
+		}
+	}
+	return append(append([]SortKey(nil), q.Sort...), SortKey{Column: "ID"})
+}
+
+// KeyValues returns the values of Keys in row, an entity struct. They make
+// up the cursor that continues after row.
+func (q ListQuery) KeyValues(row any) []any {
+	rv := reflect.ValueOf(row)
+
+	var values []any
+	for _, key := range q.Keys() {
+		values = append(values, rv.FieldByName(key.Column).Interface())
+	}
+	return values
+}
+
+// where renders the conditions of q on table as a WHERE clause. Columns are
+// qualified with the table name so that the clause also works on joins. The
+// keyset condition is left out when counting, so the total covers every page.
+func (q ListQuery) where(table string, counting bool) (string, []any) {
+	var conds []string
+	var args []any
+
+	for _, f := range q.Filters {
+		switch f.Op {
+		case "=", "<", "<=", ">", ">=":
+		default:
+			panic(fmt.Sprintf("repository: unsupported filter operator %q", f.Op))
+		}
+		if ref, ok := f.Value.(Ref); ok {
+			conds = append(conds, table+"."+f.Column+" "+f.Op+" "+table+"."+string(ref))
+			continue
+		}
+		conds = append(conds, table+"."+f.Column+" "+f.Op+" ?")
+		args = append(args, f.Value)
+	}
+
+	// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with < for descending keys.
+	if !counting && q.After != nil {
+		var ors []string
+		for i, key := range q.Keys() {
+			var ands []string
+			for j := 0; j < i; j++ {
+				ands = append(ands, table+"."+q.Keys()[j].Column+" = ?")
+				args = append(args, q.After[j])
+			}
+			op := " > ?"
+			if key.Desc {
+				op = " < ?"
+			}
+			ands = append(ands, table+"."+key.Column+op)
+			args = append(args, q.After[i])
+			ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+		}
+		conds = append(conds, "("+strings.Join(ors, " OR ")+")")
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// tail renders the ORDER BY and LIMIT clauses of q on table.
+func (q ListQuery) tail(table string) string {
+	var order []string
+	for _, key := range q.Keys() {
+		if key.Desc {
+			order = append(order, table+"."+key.Column+" DESC")
+		} else {
+			order = append(order, table+"."+key.Column)
+		}
+	}
+
+	clause := " ORDER BY " + strings.Join(order, ", ")
+	if q.Limit > 0 {
+		clause += " LIMIT " + strconv.Itoa(q.Limit) + " OFFSET " + strconv.Itoa(q.Offset)
+	}
+	return clause
+}
+
+// count returns the number of rows in table matching q, ignoring its paging.
+func (d Dialect) count(ctx context.Context, db dbtx, table string, q ListQuery) (int, error) {
+	where, args := q.where(table, true)
+
+	var total int
+	err := db.QueryRowContext(ctx, d.Rebind(`SELECT COUNT(*) FROM `+table+where), args...).Scan(&total)
+	return total, err
+}
+
+// page applies q to rows, returning the selected rows and how many matched
+// before paging. It is the in-memory counterpart of where and tail.
+func page[T any](rows []T, q ListQuery) ([]T, int) {
+	var matched []T
+	for _, row := range rows {
+		if q.matches(row) {
+			matched = append(matched, row)
+		}
+	}
+	total := len(matched)
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return q.compare(q.KeyValues(matched[i]), q.KeyValues(matched[j])) < 0
+	})
+
+	if q.After != nil {
+		start := 0
+		for start < len(matched) && q.compare(q.KeyValues(matched[start]), q.After) <= 0 {
+			start++
+		}
+		matched = matched[start:]
+	}
+
+	if q.Offset >= len(matched) {
+		return nil, total
+	}
+	matched = matched[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(matched) {
+		matched = matched[:q.Limit]
+	}
+	return matched, total
+}
+
+func (q ListQuery) matches(row any) bool {
+	rv := reflect.ValueOf(row)
+	for _, f := range q.Filters {
+		value := f.Value
+		if ref, ok := value.(Ref); ok {
+			value = rv.FieldByName(string(ref)).Interface()
+		}
+		c := compareValues(rv.FieldByName(f.Column).Interface(), value)
+		var ok bool
+		switch f.Op {
+		case "=":
+			ok = c == 0
+		case "<":
+			ok = c < 0
+		case "<=":
+			ok = c <= 0
+		case ">":
+			ok = c > 0
+		case ">=":
+			ok = c >= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compare orders two KeyValues results the way tail does.
+func (q ListQuery) compare(a, b []any) int {
+	for i, key := range q.Keys() {
+		c := compareValues(a[i], b[i])
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareValues compares the int and string columns of the entity types.
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case int:
+		b, _ := b.(int)
+		return cmp.Compare(a, b)
+	case string:
+		b, _ := b.(string)
+		return cmp.Compare(a, b)
+	}
+	panic(fmt.Sprintf("repository: cannot compare %T values", a))
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"ngc4/entity"
+	"time"
+)
+
+type sqlLoanRepository struct {
+	db      *sql.DB
+	dialect Dialect
+	items   *sqlItemRepository
+}
+
+func (r *sqlLoanRepository) List(ctx context.Context, q ListQuery) ([]entity.Loan, int, error) {
+	total, err := r.dialect.count(ctx, r.db, "loan", q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where, args := q.where("loan", false)
+	loans, err := r.selectRows(ctx, r.db, where+q.tail("loan"), args...)
+	return loans, total, err
+}
+
+func (r *sqlLoanRepository) selectRows(ctx context.Context, db dbtx, clause string, args ...any) ([]entity.Loan, error) {
+	var loans []entity.Loan
+
+	query := `SELECT ID, ItemID, HeroID, Quantity, Status, ` + r.dialect.dateTime("CheckedOutAt") + `, ` +
+		r.dialect.dateTime("DueAt") + `, ` + r.dialect.dateTime("ReturnedAt") + ` FROM loan` + clause
+
+	rows, err := db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		l := entity.Loan{}
+		err := rows.Scan(&l.ID, &l.ItemID, &l.HeroID, &l.Quantity, &l.Status, &l.CheckedOutAt, &l.DueAt, &l.ReturnedAt)
+		if err != nil {
+			return nil, err
+		}
+		loans = append(loans, l)
+	}
+	return loans, rows.Err()
+}
+
+func (r *sqlLoanRepository) FindByID(ctx context.Context, id int) (entity.Loan, error) {
+	return r.findByID(ctx, r.db, id)
+}
+
+func (r *sqlLoanRepository) findByID(ctx context.Context, db dbtx, id int) (entity.Loan, error) {
+	loans, err := r.selectRows(ctx, db, ` WHERE ID = ?`, id)
+	if err != nil {
+		return entity.Loan{}, err
+	}
+	if len(loans) == 0 {
+		return entity.Loan{}, ErrNotFound
+	}
+	return loans[0], nil
+}
+
+// Checkout stores the loan first so that the movement it records can name it;
+// a failed stock update rolls the loan back. The UPDATE taking the units out
+// also checks that the item is Active, so a concurrent transition cannot slip
+// in between.
+func (r *sqlLoanRepository) Checkout(ctx context.Context, loan *entity.Loan) (entity.Item, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Item{}, err
+	}
+	defer tx.Rollback()
+
+	checkedOutAt := time.Now().UTC().Format(time.DateTime)
+	id, err := r.dialect.insertRow(ctx, tx, "loan", 0,
+		[]string{"ItemID", "HeroID", "Quantity", "Status", "CheckedOutAt", "DueAt"},
+		loan.ItemID, loan.HeroID, loan.Quantity, entity.LoanOut, checkedOutAt, loan.DueAt)
+	if err != nil {
+		return entity.Item{}, err
+	}
+
+	reason := fmt.Sprintf("checked out to hero %d on loan %d", loan.HeroID, id)
+	item, err := r.items.adjust(ctx, tx, loan.ItemID, -loan.Quantity, reason, entity.ItemActive)
+	if err != nil {
+		return item, err
+	}
+	if err := tx.Commit(); err != nil {
+		return entity.Item{}, err
+	}
+
+	loan.ID = id
+	loan.Status = entity.LoanOut
+	loan.CheckedOutAt = checkedOutAt
+	loan.ReturnedAt = nil
+	return item, nil
+}
+
+// Return closes the loan with a conditional UPDATE, so a loan returned twice
+// at the same time only goes back into stock once.
+func (r *sqlLoanRepository) Return(ctx context.Context, id int, broken bool) (entity.Loan, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Loan{}, err
+	}
+	defer tx.Rollback()
+
+	loan, err := r.findByID(ctx, tx, id)
+	if err != nil {
+		return loan, err
+	}
+
+	status := entity.LoanReturned
+	if broken {
+		status = entity.LoanBroken
+	}
+	returnedAt := time.Now().UTC().Format(time.DateTime)
+
+	query := `
+        UPDATE loan
+        SET Status = ?, ReturnedAt = ?
+        WHERE ID = ? AND Status = ?
+    `
+	result, err := tx.ExecContext(ctx, r.dialect.Rebind(query), status, returnedAt, id, entity.LoanOut)
+	if err != nil {
+		return loan, translate(err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return loan, err
+	} else if n == 0 {
+		return loan, fmt.Errorf("%w: loan %d", ErrReturned, id)
+	}
+
+	if broken {
+		item, err := r.items.findByID(ctx, tx, loan.ItemID)
+		if err != nil {
+			return loan, err
+		}
+		if err := r.dialect.recordMovement(ctx, tx, newMovement(ctx, item, 0, brokenReason(loan))); err != nil {
+			return loan, err
+		}
+	} else {
+		reason := fmt.Sprintf("returned by hero %d on loan %d", loan.HeroID, id)
+		if _, err := r.items.adjust(ctx, tx, loan.ItemID, loan.Quantity, reason, ""); err != nil {
+			return loan, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return loan, err
+	}
+
+	loan.Status = status
+	loan.ReturnedAt = &returnedAt
+	return loan, nil
+}
+
+// brokenReason is the reason of the movement recording the units of loan that
+// came back broken. It does not change Stock: the units were taken out of it
+// on checkout and stay out.
+func brokenReason(loan entity.Loan) string {
+	return fmt.Sprintf("%d returned broken by hero %d on loan %d", loan.Quantity, loan.HeroID, loan.ID)
+}
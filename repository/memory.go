@@ -0,0 +1,805 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"ngc4/entity"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryDB holds the tables of the in-memory backend. It enforces the same
+// constraints as the schema in migration/sql: auto-increment IDs, NOT NULL
+// columns (an empty string counts as NULL), the item Status CHECK, unique
+// ItemCodes, the CrimeEvent foreign keys to Heroes and Villain and the loan
+// foreign keys to Heroes and item.
+type memoryDB struct {
+	mu sync.RWMutex
+
+	heroes      map[int]entity.Heroes
+	villains    map[int]entity.Villain
+	crimeEvents map[int]entity.CrimeEvent
+	items       map[int]entity.Item
+	movements   []entity.Movement
+	statuses    []entity.StatusChange
+	loans       map[int]entity.Loan
+
+	nextHeroID       int
+	nextVillainID    int
+	nextCrimeEventID int
+	nextItemID       int
+	nextMovementID   int
+	nextStatusID     int
+	nextLoanID       int
+}
+
+// NewMemoryStore returns repositories that keep every table in process
+// memory. Data is lost when the process exits. Items created without an
+// ItemCode get one from codes.
+func NewMemoryStore(codes ItemCodes) Store {
+	db := &memoryDB{
+		heroes:           map[int]entity.Heroes{},
+		villains:         map[int]entity.Villain{},
+		crimeEvents:      map[int]entity.CrimeEvent{},
+		items:            map[int]entity.Item{},
+		loans:            map[int]entity.Loan{},
+		nextHeroID:       1,
+		nextVillainID:    1,
+		nextCrimeEventID: 1,
+		nextItemID:       1,
+		nextMovementID:   1,
+		nextStatusID:     1,
+		nextLoanID:       1,
+	}
+
+	items := &memoryItemRepository{db: db, codes: codes}
+	return Store{
+		Heroes:      &memoryHeroRepository{db: db},
+		Villains:    &memoryVillainRepository{db: db},
+		CrimeEvents: &memoryCrimeEventRepository{db: db},
+		Items:       items,
+		Loans:       &memoryLoanRepository{db: db, items: items},
+	}
+}
+
+func sortedIDs[T any](rows map[int]T) []int {
+	ids := make([]int, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// assignID picks the key for a new row the way AUTO_INCREMENT does: zero
+// means "generate one", anything else is used as-is and moves the counter
+// past it.
+func assignID[T any](table string, rows map[int]T, next *int, id int) (int, error) {
+	if id == 0 {
+		id = *next
+	} else if _, ok := rows[id]; ok {
+		return 0, fmt.Errorf("%w: duplicate %s ID %d", ErrConstraint, table, id)
+	}
+	if id >= *next {
+		*next = id + 1
+	}
+	return id, nil
+}
+
+// stale is the error for a write that expected version of row id in table
+// when the stored row has moved on.
+func stale(table string, id int) error {
+	return fmt.Errorf("%w: %s %d", ErrStale, table, id)
+}
+
+func notNull(table, column, value string) error {
+	if value == "" {
+		return fmt.Errorf("%w: %s.%s cannot be null", ErrInvalid, table, column)
+	}
+	return nil
+}
+
+type memoryHeroRepository struct {
+	db *memoryDB
+}
+
+func checkHero(hero entity.Heroes) error {
+	if err := notNull("Heroes", "Name", hero.Name); err != nil {
+		return err
+	}
+	return notNull("Heroes", "Universe", hero.Universe)
+}
+
+func (r *memoryHeroRepository) FindAll(ctx context.Context) ([]entity.Heroes, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var hero []entity.Heroes
+	for _, id := range sortedIDs(r.db.heroes) {
+		hero = append(hero, r.db.heroes[id])
+	}
+	return hero, nil
+}
+
+func (r *memoryHeroRepository) List(ctx context.Context, q ListQuery) ([]entity.Heroes, int, error) {
+	all, err := r.FindAll(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hero, total := page(all, q)
+	return hero, total, nil
+}
+
+func (r *memoryHeroRepository) FindByID(ctx context.Context, id int) (entity.Heroes, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	hero, ok := r.db.heroes[id]
+	if !ok {
+		return entity.Heroes{}, ErrNotFound
+	}
+	return hero, nil
+}
+
+func (r *memoryHeroRepository) Create(ctx context.Context, hero *entity.Heroes) error {
+	if err := checkHero(*hero); err != nil {
+		return err
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	id, err := assignID("Heroes", r.db.heroes, &r.db.nextHeroID, hero.ID)
+	if err != nil {
+		return err
+	}
+	hero.ID = id
+	hero.Version = 1
+	r.db.heroes[hero.ID] = *hero
+	return nil
+}
+
+func (r *memoryHeroRepository) Update(ctx context.Context, hero entity.Heroes) error {
+	if err := checkHero(hero); err != nil {
+		return err
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.heroes[hero.ID]
+	if !ok {
+		return nil
+	}
+	if stored.Version != hero.Version {
+		return stale("Heroes", hero.ID)
+	}
+	hero.Version++
+	r.db.heroes[hero.ID] = hero
+	return nil
+}
+
+func (r *memoryHeroRepository) Delete(ctx context.Context, id, version int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.heroes[id]
+	if !ok {
+		return nil
+	}
+	if stored.Version != version {
+		return stale("Heroes", id)
+	}
+
+	for _, ce := range r.db.crimeEvents {
+		if ce.HeroID == id {
+			return fmt.Errorf("%w: hero %d is referenced by crime event %d", ErrConstraint, id, ce.ID)
+		}
+	}
+	for _, loan := range r.db.loans {
+		if loan.HeroID == id {
+			return fmt.Errorf("%w: hero %d is referenced by loan %d", ErrConstraint, id, loan.ID)
+		}
+	}
+	delete(r.db.heroes, id)
+	return nil
+}
+
+type memoryVillainRepository struct {
+	db *memoryDB
+}
+
+func checkVillain(villain entity.Villain) error {
+	if err := notNull("Villain", "Name", villain.Name); err != nil {
+		return err
+	}
+	return notNull("Villain", "Universe", villain.Universe)
+}
+
+func (r *memoryVillainRepository) FindAll(ctx context.Context) ([]entity.Villain, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var villain []entity.Villain
+	for _, id := range sortedIDs(r.db.villains) {
+		villain = append(villain, r.db.villains[id])
+	}
+	return villain, nil
+}
+
+func (r *memoryVillainRepository) List(ctx context.Context, q ListQuery) ([]entity.Villain, int, error) {
+	all, err := r.FindAll(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	villain, total := page(all, q)
+	return villain, total, nil
+}
+
+func (r *memoryVillainRepository) FindByID(ctx context.Context, id int) (entity.Villain, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	villain, ok := r.db.villains[id]
+	if !ok {
+		return entity.Villain{}, ErrNotFound
+	}
+	return villain, nil
+}
+
+func (r *memoryVillainRepository) Create(ctx context.Context, villain *entity.Villain) error {
+	if err := checkVillain(*villain); err != nil {
+		return err
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	id, err := assignID("Villain", r.db.villains, &r.db.nextVillainID, villain.ID)
+	if err != nil {
+		return err
+	}
+	villain.ID = id
+	villain.Version = 1
+	r.db.villains[villain.ID] = *villain
+	return nil
+}
+
+func (r *memoryVillainRepository) Update(ctx context.Context, villain entity.Villain) error {
+	if err := checkVillain(villain); err != nil {
+		return err
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.villains[villain.ID]
+	if !ok {
+		return nil
+	}
+	if stored.Version != villain.Version {
+		return stale("Villain", villain.ID)
+	}
+	villain.Version++
+	r.db.villains[villain.ID] = villain
+	return nil
+}
+
+func (r *memoryVillainRepository) Delete(ctx context.Context, id, version int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.villains[id]
+	if !ok {
+		return nil
+	}
+	if stored.Version != version {
+		return stale("Villain", id)
+	}
+
+	for _, ce := range r.db.crimeEvents {
+		if ce.VillainID == id {
+			return fmt.Errorf("%w: villain %d is referenced by crime event %d", ErrConstraint, id, ce.ID)
+		}
+	}
+	delete(r.db.villains, id)
+	return nil
+}
+
+type memoryCrimeEventRepository struct {
+	db *memoryDB
+}
+
+// checkCrimeEvent must be called with r.db.mu held.
+func (r *memoryCrimeEventRepository) checkCrimeEvent(crimeEvent entity.CrimeEvent) error {
+	if _, ok := r.db.heroes[crimeEvent.HeroID]; !ok {
+		return fmt.Errorf("%w: hero %d does not exist", ErrConstraint, crimeEvent.HeroID)
+	}
+	if _, ok := r.db.villains[crimeEvent.VillainID]; !ok {
+		return fmt.Errorf("%w: villain %d does not exist", ErrConstraint, crimeEvent.VillainID)
+	}
+	return nil
+}
+
+func (r *memoryCrimeEventRepository) FindAll(ctx context.Context) ([]entity.CrimeEvent, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var crimeEvent []entity.CrimeEvent
+	for _, id := range sortedIDs(r.db.crimeEvents) {
+		crimeEvent = append(crimeEvent, r.db.crimeEvents[id])
+	}
+	return crimeEvent, nil
+}
+
+func (r *memoryCrimeEventRepository) List(ctx context.Context, q ListQuery) ([]entity.CrimeEvent, int, error) {
+	all, err := r.FindAll(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	crimeEvent, total := page(all, q)
+	return crimeEvent, total, nil
+}
+
+func (r *memoryCrimeEventRepository) FindByID(ctx context.Context, id int) (entity.CrimeEvent, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	crimeEvent, ok := r.db.crimeEvents[id]
+	if !ok {
+		return entity.CrimeEvent{}, ErrNotFound
+	}
+	return crimeEvent, nil
+}
+
+func (r *memoryCrimeEventRepository) ListWithRelations(ctx context.Context, q ListQuery) ([]entity.CrimeEventDetail, int, error) {
+	crimeEvent, total, err := r.List(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	details := make([]entity.CrimeEventDetail, len(crimeEvent))
+	for i, ce := range crimeEvent {
+		details[i] = r.detail(ce)
+	}
+	return details, total, nil
+}
+
+func (r *memoryCrimeEventRepository) FindByIDWithRelations(ctx context.Context, id int) (entity.CrimeEventDetail, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	crimeEvent, ok := r.db.crimeEvents[id]
+	if !ok {
+		return entity.CrimeEventDetail{}, ErrNotFound
+	}
+	return r.detail(crimeEvent), nil
+}
+
+// detail must be called with r.db.mu held.
+func (r *memoryCrimeEventRepository) detail(crimeEvent entity.CrimeEvent) entity.CrimeEventDetail {
+	hero := r.db.heroes[crimeEvent.HeroID]
+	villain := r.db.villains[crimeEvent.VillainID]
+	return entity.CrimeEventDetail{CrimeEvent: crimeEvent, Hero: &hero, Villain: &villain}
+}
+
+func (r *memoryCrimeEventRepository) Create(ctx context.Context, crimeEvent *entity.CrimeEvent) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if err := r.checkCrimeEvent(*crimeEvent); err != nil {
+		return err
+	}
+
+	id, err := assignID("CrimeEvent", r.db.crimeEvents, &r.db.nextCrimeEventID, crimeEvent.ID)
+	if err != nil {
+		return err
+	}
+	crimeEvent.ID = id
+	crimeEvent.Version = 1
+	r.db.crimeEvents[crimeEvent.ID] = *crimeEvent
+	return nil
+}
+
+func (r *memoryCrimeEventRepository) Update(ctx context.Context, crimeEvent entity.CrimeEvent) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.crimeEvents[crimeEvent.ID]
+	if !ok {
+		return nil
+	}
+	if stored.Version != crimeEvent.Version {
+		return stale("CrimeEvent", crimeEvent.ID)
+	}
+	if err := r.checkCrimeEvent(crimeEvent); err != nil {
+		return err
+	}
+	crimeEvent.Version++
+	r.db.crimeEvents[crimeEvent.ID] = crimeEvent
+	return nil
+}
+
+func (r *memoryCrimeEventRepository) Delete(ctx context.Context, id, version int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.crimeEvents[id]
+	if !ok {
+		return nil
+	}
+	if stored.Version != version {
+		return stale("CrimeEvent", id)
+	}
+
+	delete(r.db.crimeEvents, id)
+	return nil
+}
+
+type memoryItemRepository struct {
+	db    *memoryDB
+	codes ItemCodes
+}
+
+func checkItem(item entity.Item) error {
+	if err := notNull("item", "Name", item.Name); err != nil {
+		return err
+	}
+	if err := notNull("item", "ItemCode", item.ItemCode); err != nil {
+		return err
+	}
+	switch item.Status {
+	case entity.ItemActive, entity.ItemBroken, entity.ItemInRepair, entity.ItemRetired:
+	default:
+		return fmt.Errorf("%w: item.Status must be 'Active', 'Broken', 'InRepair' or 'Retired', got %q", ErrInvalid, item.Status)
+	}
+	return nil
+}
+
+// checkItemCode enforces the unique index on ItemCode. The caller holds the
+// lock.
+func (r *memoryItemRepository) checkItemCode(item entity.Item) error {
+	for _, other := range r.db.items {
+		if other.ItemCode == item.ItemCode && other.ID != item.ID {
+			return fmt.Errorf("%w: duplicate item ItemCode %q", ErrConstraint, item.ItemCode)
+		}
+	}
+	return nil
+}
+
+func (r *memoryItemRepository) FindAll(ctx context.Context) ([]entity.Item, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var item []entity.Item
+	for _, id := range sortedIDs(r.db.items) {
+		item = append(item, r.db.items[id])
+	}
+	return item, nil
+}
+
+func (r *memoryItemRepository) List(ctx context.Context, q ListQuery) ([]entity.Item, int, error) {
+	all, err := r.FindAll(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	item, total := page(all, q)
+	return item, total, nil
+}
+
+func (r *memoryItemRepository) FindByID(ctx context.Context, id int) (entity.Item, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	item, ok := r.db.items[id]
+	if !ok {
+		return entity.Item{}, ErrNotFound
+	}
+	return item, nil
+}
+
+func (r *memoryItemRepository) FindByCode(ctx context.Context, code string) (entity.Item, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, item := range r.db.items {
+		if item.ItemCode == code {
+			return item, nil
+		}
+	}
+	return entity.Item{}, ErrNotFound
+}
+
+func (r *memoryItemRepository) Create(ctx context.Context, item *entity.Item) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	created := *item
+	if created.ItemCode == "" {
+		codes := make([]string, 0, len(r.db.items))
+		for _, other := range r.db.items {
+			codes = append(codes, other.ItemCode)
+		}
+		created.ItemCode = r.codes.next(codes)
+	}
+	if err := checkItem(created); err != nil {
+		return err
+	}
+	if err := r.checkItemCode(created); err != nil {
+		return err
+	}
+
+	id, err := assignID("item", r.db.items, &r.db.nextItemID, created.ID)
+	if err != nil {
+		return err
+	}
+	*item = created
+	item.ID = id
+	item.Version = 1
+	r.db.items[item.ID] = *item
+	r.record(newMovement(ctx, *item, item.Stock, ReasonCreated))
+	r.recordStatus(newStatusChange(ctx, item.ID, "", item.Status, ReasonCreated))
+	return nil
+}
+
+func (r *memoryItemRepository) Update(ctx context.Context, item entity.Item) error {
+	if err := checkItem(item); err != nil {
+		return err
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.items[item.ID]
+	if !ok {
+		return nil
+	}
+	if stored.Version != item.Version {
+		return stale("item", item.ID)
+	}
+	if err := r.checkItemCode(item); err != nil {
+		return err
+	}
+	item.Version++
+	r.db.items[item.ID] = item
+	if delta := item.Stock - stored.Stock; delta != 0 {
+		r.record(newMovement(ctx, item, delta, ReasonUpdated))
+	}
+	if item.Status != stored.Status {
+		r.recordStatus(newStatusChange(ctx, item.ID, stored.Status, item.Status, ReasonUpdated))
+	}
+	return nil
+}
+
+func (r *memoryItemRepository) AdjustStock(ctx context.Context, id, delta int, reason string) (entity.Item, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	return r.adjust(ctx, id, delta, reason, "")
+}
+
+// adjust is AdjustStock for a caller that holds the write lock. A non-empty
+// status is the one the item must be in, as for sqlItemRepository.adjust.
+func (r *memoryItemRepository) adjust(ctx context.Context, id, delta int, reason, status string) (entity.Item, error) {
+	item, ok := r.db.items[id]
+	if !ok {
+		return entity.Item{}, ErrNotFound
+	}
+	if status != "" && item.Status != status {
+		return item, fmt.Errorf("%w: item %d is %s, not %s", ErrUnavailable, id, item.Status, status)
+	}
+	if item.Stock+delta < 0 {
+		return item, fmt.Errorf("%w: item %d has %d in stock, cannot apply %d", ErrInsufficientStock, id, item.Stock, delta)
+	}
+	item.Stock += delta
+	item.Version++
+	r.db.items[id] = item
+	r.record(newMovement(ctx, item, delta, reason))
+	return item, nil
+}
+
+func (r *memoryItemRepository) Delete(ctx context.Context, id, version int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.items[id]
+	if !ok {
+		return nil
+	}
+	if stored.Version != version {
+		return stale("item", id)
+	}
+	for _, loan := range r.db.loans {
+		if loan.ItemID == id {
+			return fmt.Errorf("%w: item %d is referenced by loan %d", ErrConstraint, id, loan.ID)
+		}
+	}
+
+	delete(r.db.items, id)
+	closed := stored
+	closed.Stock = 0
+	r.record(newMovement(ctx, closed, -stored.Stock, ReasonDeleted))
+	return nil
+}
+
+// record appends m to the ledger. The caller holds the write lock.
+func (r *memoryItemRepository) record(m entity.Movement) {
+	m.ID = r.db.nextMovementID
+	r.db.nextMovementID++
+	r.db.movements = append(r.db.movements, m)
+}
+
+// recordStatus appends c to the status history. The caller holds the write
+// lock.
+func (r *memoryItemRepository) recordStatus(c entity.StatusChange) {
+	c.ID = r.db.nextStatusID
+	r.db.nextStatusID++
+	r.db.statuses = append(r.db.statuses, c)
+}
+
+func (r *memoryItemRepository) Transition(ctx context.Context, id, version int, to, reason string) (entity.Item, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	item, ok := r.db.items[id]
+	if !ok {
+		return entity.Item{}, ErrNotFound
+	}
+	if item.Version != version {
+		return item, stale("item", id)
+	}
+	if !entity.ItemCanTransition(item.Status, to) {
+		return item, fmt.Errorf("%w: item %d cannot go from %s to %s", ErrTransition, id, item.Status, to)
+	}
+
+	r.recordStatus(newStatusChange(ctx, id, item.Status, to, reason))
+	item.Status = to
+	item.Version++
+	r.db.items[id] = item
+	return item, nil
+}
+
+func (r *memoryItemRepository) ListStatusHistory(ctx context.Context, id int, q ListQuery) ([]entity.StatusChange, int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var changes []entity.StatusChange
+	for _, c := range r.db.statuses {
+		if c.ItemID == id {
+			changes = append(changes, c)
+		}
+	}
+
+	changes, total := page(changes, q)
+	return changes, total, nil
+}
+
+func (r *memoryItemRepository) ListMovements(ctx context.Context, id int, q ListQuery) ([]entity.Movement, int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var movements []entity.Movement
+	for _, m := range r.db.movements {
+		if m.ItemID == id {
+			movements = append(movements, m)
+		}
+	}
+
+	movements, total := page(movements, q)
+	return movements, total, nil
+}
+
+func (r *memoryItemRepository) Reconcile(ctx context.Context) ([]StockDiscrepancy, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	ledger := map[int]int{}
+	for _, m := range r.db.movements {
+		ledger[m.ItemID] += m.Delta
+	}
+
+	var discrepancies []StockDiscrepancy
+	for _, id := range sortedIDs(r.db.items) {
+		if stock := r.db.items[id].Stock; stock != ledger[id] {
+			discrepancies = append(discrepancies, StockDiscrepancy{ItemID: id, Stock: stock, Ledger: ledger[id]})
+		}
+	}
+	return discrepancies, nil
+}
+
+type memoryLoanRepository struct {
+	db    *memoryDB
+	items *memoryItemRepository
+}
+
+func (r *memoryLoanRepository) List(ctx context.Context, q ListQuery) ([]entity.Loan, int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var loans []entity.Loan
+	for _, id := range sortedIDs(r.db.loans) {
+		loans = append(loans, r.db.loans[id])
+	}
+
+	loans, total := page(loans, q)
+	return loans, total, nil
+}
+
+func (r *memoryLoanRepository) FindByID(ctx context.Context, id int) (entity.Loan, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	loan, ok := r.db.loans[id]
+	if !ok {
+		return entity.Loan{}, ErrNotFound
+	}
+	return loan, nil
+}
+
+func (r *memoryLoanRepository) Checkout(ctx context.Context, loan *entity.Loan) (entity.Item, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.heroes[loan.HeroID]; !ok {
+		return entity.Item{}, fmt.Errorf("%w: loan.HeroID %d does not exist", ErrConstraint, loan.HeroID)
+	}
+	if _, ok := r.db.items[loan.ItemID]; !ok {
+		return entity.Item{}, fmt.Errorf("%w: loan.ItemID %d does not exist", ErrConstraint, loan.ItemID)
+	}
+
+	id := r.db.nextLoanID
+	reason := fmt.Sprintf("checked out to hero %d on loan %d", loan.HeroID, id)
+	item, err := r.items.adjust(ctx, loan.ItemID, -loan.Quantity, reason, entity.ItemActive)
+	if err != nil {
+		return item, err
+	}
+
+	r.db.nextLoanID++
+	loan.ID = id
+	loan.Status = entity.LoanOut
+	loan.CheckedOutAt = time.Now().UTC().Format(time.DateTime)
+	loan.ReturnedAt = nil
+	r.db.loans[id] = *loan
+	return item, nil
+}
+
+func (r *memoryLoanRepository) Return(ctx context.Context, id int, broken bool) (entity.Loan, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	loan, ok := r.db.loans[id]
+	if !ok {
+		return entity.Loan{}, ErrNotFound
+	}
+	if loan.Status != entity.LoanOut {
+		return loan, fmt.Errorf("%w: loan %d", ErrReturned, id)
+	}
+
+	if broken {
+		item, ok := r.db.items[loan.ItemID]
+		if !ok {
+			return loan, ErrNotFound
+		}
+		r.items.record(newMovement(ctx, item, 0, brokenReason(loan)))
+		loan.Status = entity.LoanBroken
+	} else {
+		reason := fmt.Sprintf("returned by hero %d on loan %d", loan.HeroID, id)
+		if _, err := r.items.adjust(ctx, loan.ItemID, loan.Quantity, reason, ""); err != nil {
+			return loan, err
+		}
+		loan.Status = entity.LoanReturned
+	}
+
+	returnedAt := time.Now().UTC().Format(time.DateTime)
+	loan.ReturnedAt = &returnedAt
+	r.db.loans[id] = loan
+	return loan, nil
+}
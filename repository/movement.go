@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"ngc4/entity"
+	"time"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context that attributes the stock movements written
+// through it to actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom returns the actor set by WithActor, or "system" when there is
+// none.
+func actorFrom(ctx context.Context) string {
+	if actor, _ := ctx.Value(actorKey{}).(string); actor != "" {
+		return actor
+	}
+	return "system"
+}
+
+// The reasons recorded for stock changes that do not state their own.
+const (
+	ReasonCreated = "created"
+	ReasonUpdated = "updated"
+	ReasonDeleted = "deleted"
+)
+
+// StockDiscrepancy is an item whose Stock differs from the sum of its
+// movements.
+type StockDiscrepancy struct {
+	ItemID int
+	Stock  int
+	Ledger int
+}
+
+// newMovement is the ledger entry for item, which delta has just changed.
+func newMovement(ctx context.Context, item entity.Item, delta int, reason string) entity.Movement {
+	return entity.Movement{
+		ItemID:    item.ID,
+		Delta:     delta,
+		Stock:     item.Stock,
+		Reason:    reason,
+		Actor:     actorFrom(ctx),
+		CreatedAt: time.Now().UTC().Format(time.DateTime),
+	}
+}
+
+// recordMovement appends m to the ledger. It runs in the transaction of the
+// stock change it records.
+func (d Dialect) recordMovement(ctx context.Context, db dbtx, m entity.Movement) error {
+	_, err := d.insertRow(ctx, db, "item_movement", 0,
+		[]string{"ItemID", "Delta", "Stock", "Reason", "Actor", "CreatedAt"},
+		m.ItemID, m.Delta, m.Stock, m.Reason, m.Actor, m.CreatedAt)
+	return err
+}
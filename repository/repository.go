@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ngc4/entity"
+)
+
+var (
+	// ErrNotFound is returned when no row matches the requested ID.
+	ErrNotFound = errors.New("record not found")
+	// ErrInvalid is returned when a value breaks a NOT NULL or CHECK
+	// constraint.
+	ErrInvalid = errors.New("invalid value")
+	// ErrConstraint is returned when a write conflicts with other rows: a
+	// duplicate key or a foreign key.
+	ErrConstraint = errors.New("constraint violation")
+	// ErrStale is returned by Update and Delete when the row has been
+	// written since the version they were given was read.
+	ErrStale = errors.New("stale version")
+	// ErrInsufficientStock is returned when a stock adjustment would take
+	// an item below zero.
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrReturned is returned when a loan that is no longer out is
+	// returned again.
+	ErrReturned = errors.New("loan already returned")
+	// ErrTransition is returned when an item is moved to a status its
+	// current one does not lead to, see entity.ItemCanTransition.
+	ErrTransition = errors.New("illegal status transition")
+	// ErrUnavailable is returned when units of an item that is not Active
+	// are checked out.
+	ErrUnavailable = errors.New("item unavailable")
+)
+
+// HeroRepository stores heroes. Its methods set the conventions the other
+// repositories follow:
+//
+// List returns the page of rows selected by q together with the number of
+// rows the whole listing holds.
+//
+// Create stores the row under its ID when that is non-zero and lets the
+// backend generate one otherwise, writing the result back into the argument.
+// New rows start at Version 1.
+//
+// Update and Delete are optimistic: they only apply while the stored Version
+// still equals the one passed in, and fail with ErrStale otherwise. Update
+// stores Version+1. Neither treats a missing row as an error.
+type HeroRepository interface {
+	FindAll(ctx context.Context) ([]entity.Heroes, error)
+	List(ctx context.Context, q ListQuery) ([]entity.Heroes, int, error)
+	FindByID(ctx context.Context, id int) (entity.Heroes, error)
+	Create(ctx context.Context, hero *entity.Heroes) error
+	Update(ctx context.Context, hero entity.Heroes) error
+	Delete(ctx context.Context, id, version int) error
+}
+
+// VillainRepository stores villains like HeroRepository stores heroes.
+type VillainRepository interface {
+	FindAll(ctx context.Context) ([]entity.Villain, error)
+	List(ctx context.Context, q ListQuery) ([]entity.Villain, int, error)
+	FindByID(ctx context.Context, id int) (entity.Villain, error)
+	Create(ctx context.Context, villain *entity.Villain) error
+	Update(ctx context.Context, villain entity.Villain) error
+	Delete(ctx context.Context, id, version int) error
+}
+
+// CrimeEventRepository stores crime events like HeroRepository stores
+// heroes.
+type CrimeEventRepository interface {
+	FindAll(ctx context.Context) ([]entity.CrimeEvent, error)
+	List(ctx context.Context, q ListQuery) ([]entity.CrimeEvent, int, error)
+	FindByID(ctx context.Context, id int) (entity.CrimeEvent, error)
+	// ListWithRelations and FindByIDWithRelations also load the hero and
+	// villain of each crime event.
+	ListWithRelations(ctx context.Context, q ListQuery) ([]entity.CrimeEventDetail, int, error)
+	FindByIDWithRelations(ctx context.Context, id int) (entity.CrimeEventDetail, error)
+	Create(ctx context.Context, crimeEvent *entity.CrimeEvent) error
+	Update(ctx context.Context, crimeEvent entity.CrimeEvent) error
+	Delete(ctx context.Context, id, version int) error
+}
+
+// ItemRepository stores items like HeroRepository stores heroes. It records
+// every change of Stock as an entity.Movement in the same transaction: Create
+// with ReasonCreated, Update with ReasonUpdated when Stock differs, and
+// AdjustStock with the reason it is given. Changes of Status are recorded the
+// same way as entity.StatusChange. The actor is taken from the context, see
+// WithActor. Both outlive the item: Delete keeps them and records a last
+// movement with ReasonDeleted that takes the remaining Stock out.
+//
+// Update stores any Status, so that fixtures can be loaded; only Transition
+// enforces the item state machine.
+type ItemRepository interface {
+	FindAll(ctx context.Context) ([]entity.Item, error)
+	List(ctx context.Context, q ListQuery) ([]entity.Item, int, error)
+	FindByID(ctx context.Context, id int) (entity.Item, error)
+	FindByCode(ctx context.Context, code string) (entity.Item, error)
+	// Create generates the ItemCode of an item that has none. ItemCodes
+	// are unique; a duplicate fails with ErrConstraint.
+	Create(ctx context.Context, item *entity.Item) error
+	// AdjustStock adds delta, which may be negative, to the Stock of item
+	// id and returns the updated item. It fails with ErrInsufficientStock
+	// instead of going below zero.
+	AdjustStock(ctx context.Context, id, delta int, reason string) (entity.Item, error)
+	Update(ctx context.Context, item entity.Item) error
+	Delete(ctx context.Context, id, version int) error
+	// Transition moves item id to status to and returns the updated item.
+	// Like Update it only applies to the item at version and fails with
+	// ErrStale otherwise. It fails with ErrTransition when the current
+	// status does not lead to to.
+	Transition(ctx context.Context, id, version int, to, reason string) (entity.Item, error)
+	// ListMovements returns a page of the ledger of item id, oldest first
+	// unless q sorts otherwise.
+	ListMovements(ctx context.Context, id int, q ListQuery) ([]entity.Movement, int, error)
+	// ListStatusHistory returns a page of the status changes of item id,
+	// oldest first unless q sorts otherwise.
+	ListStatusHistory(ctx context.Context, id int, q ListQuery) ([]entity.StatusChange, int, error)
+	// Reconcile returns the items whose Stock is not the sum of their
+	// movements, ordered by ID. It is empty when the ledger is consistent.
+	Reconcile(ctx context.Context) ([]StockDiscrepancy, error)
+}
+
+// LoanRepository checks items out to heroes and back in. Both change the
+// Stock of the item in the same transaction as the loan, recording a
+// movement like ItemRepository does.
+type LoanRepository interface {
+	List(ctx context.Context, q ListQuery) ([]entity.Loan, int, error)
+	FindByID(ctx context.Context, id int) (entity.Loan, error)
+	// Checkout takes loan.Quantity units of the item out of stock and stores
+	// the loan as Out, writing its ID, Status and CheckedOutAt back, and
+	// returns the item with the stock it left. It fails with
+	// ErrInsufficientStock when there are not enough units and with
+	// ErrUnavailable when the item is not Active.
+	Checkout(ctx context.Context, loan *entity.Loan) (entity.Item, error)
+	// Return closes loan id and returns it. Units returned in working order
+	// go back into stock. Broken ones stay out of it: the loan is closed as
+	// Broken and a movement of zero records them, leaving the Status of the
+	// item alone. A loan that is not Out fails with ErrReturned.
+	Return(ctx context.Context, id int, broken bool) (entity.Loan, error)
+}
+
+// Store groups the repositories of one storage backend.
+type Store struct {
+	Heroes      HeroRepository
+	Villains    VillainRepository
+	CrimeEvents CrimeEventRepository
+	Items       ItemRepository
+	Loans       LoanRepository
+}
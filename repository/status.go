@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"ngc4/entity"
+	"time"
+)
+
+// newStatusChange is the history entry for item id moving from one status to
+// another. from is empty when the item is created.
+func newStatusChange(ctx context.Context, id int, from, to, reason string) entity.StatusChange {
+	return entity.StatusChange{
+		ItemID:     id,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		Actor:      actorFrom(ctx),
+		ChangedAt:  time.Now().UTC().Format(time.DateTime),
+	}
+}
+
+// recordStatusChange appends c to the status history. It runs in the
+// transaction of the change it records.
+func (d Dialect) recordStatusChange(ctx context.Context, db dbtx, c entity.StatusChange) error {
+	_, err := d.insertRow(ctx, db, "item_status_history", 0,
+		[]string{"ItemID", "FromStatus", "ToStatus", "Reason", "Actor", "ChangedAt"},
+		c.ItemID, c.FromStatus, c.ToStatus, c.Reason, c.Actor, c.ChangedAt)
+	return err
+}
@@ -0,0 +1,284 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ngc4/config"
+	"ngc4/entity"
+	"ngc4/migration"
+	"ngc4/repository"
+	"ngc4/seed"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// The tests of this file run the same contract against every backend: the
+// memory store and the SQL store on a SQLite file, which needs no server.
+
+var ctx = repository.WithActor(context.Background(), "tester")
+
+// load fills store with the demo fixtures.
+func load(t *testing.T, store repository.Store) repository.Store {
+	t.Helper()
+
+	fixtures, err := seed.LoadFile("../seed/fixtures/demo.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seed.Apply(ctx, store, fixtures); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// openSQLite returns a SQL store on a migrated SQLite file, opened the way
+// the server opens it, together with its database.
+func openSQLite(t *testing.T) (repository.Store, *sql.DB) {
+	t.Helper()
+
+	db, err := config.GetDB(config.DBConfig{Driver: repository.SQLite.Driver, Name: filepath.Join(t.TempDir(), "ngc4.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migration.New(db, repository.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return load(t, repository.NewSQLStore(db, repository.SQLite, repository.DefaultItemCodes)), db
+}
+
+// forEachStore runs test against a store of every backend holding the demo
+// fixtures.
+func forEachStore(t *testing.T, test func(t *testing.T, store repository.Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, load(t, repository.NewMemoryStore(repository.DefaultItemCodes)))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		store, _ := openSQLite(t)
+		test(t, store)
+	})
+}
+
+func TestCreateUpdateDelete(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store repository.Store) {
+		// An explicit ID is kept and generated ones continue after it.
+		explicit := entity.Heroes{ID: 10, Name: "Thor", Universe: "Marvel"}
+		if err := store.Heroes.Create(ctx, &explicit); err != nil || explicit.ID != 10 || explicit.Version != 1 {
+			t.Fatalf("Create() with ID 10 = %+v, %v", explicit, err)
+		}
+		generated := entity.Heroes{Name: "Hulk", Universe: "Marvel"}
+		if err := store.Heroes.Create(ctx, &generated); err != nil || generated.ID != 11 {
+			t.Fatalf("Create() without ID = %+v, %v; want ID 11", generated, err)
+		}
+		if err := store.Heroes.Create(ctx, &entity.Heroes{ID: 10, Name: "Loki", Universe: "Marvel"}); !errors.Is(err, repository.ErrConstraint) {
+			t.Errorf("Create() with taken ID = %v, want ErrConstraint", err)
+		}
+
+		generated.Skill = "Smash"
+		if err := store.Heroes.Update(ctx, generated); err != nil {
+			t.Fatalf("Update() = %v", err)
+		}
+		if err := store.Heroes.Update(ctx, generated); !errors.Is(err, repository.ErrStale) {
+			t.Errorf("Update() of version 1 again = %v, want ErrStale", err)
+		}
+		if got, err := store.Heroes.FindByID(ctx, generated.ID); err != nil || got.Version != 2 || got.Skill != "Smash" {
+			t.Errorf("FindByID() after Update() = %+v, %v", got, err)
+		}
+
+		if err := store.Heroes.Delete(ctx, generated.ID, 1); !errors.Is(err, repository.ErrStale) {
+			t.Errorf("Delete() of version 1 = %v, want ErrStale", err)
+		}
+		if err := store.Heroes.Delete(ctx, generated.ID, 2); err != nil {
+			t.Errorf("Delete() = %v", err)
+		}
+		if err := store.Heroes.Delete(ctx, generated.ID, 2); err != nil {
+			t.Errorf("Delete() of a missing row = %v, want nil", err)
+		}
+		if _, err := store.Heroes.FindByID(ctx, generated.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("FindByID() after Delete() = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestConstraints(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store repository.Store) {
+		tests := []struct {
+			name string
+			err  error
+			want error
+		}{
+			{"item with unknown status", store.Items.Create(ctx, &entity.Item{Name: "X", ItemCode: "X2", Status: "Lost"}), repository.ErrInvalid},
+			{"item with taken code", store.Items.Create(ctx, &entity.Item{Name: "X", ItemCode: "CODE001", Status: entity.ItemActive}), repository.ErrConstraint},
+			{"crime event of unknown hero", store.CrimeEvents.Create(ctx,
+				&entity.CrimeEvent{HeroID: 99, VillainID: 1, DateTime: "2024-01-01 00:00:00"}), repository.ErrConstraint},
+			{"delete hero with crime events", store.Heroes.Delete(ctx, 1, 1), repository.ErrConstraint},
+		}
+		for _, tt := range tests {
+			if !errors.Is(tt.err, tt.want) {
+				t.Errorf("%s: error %v, want %v", tt.name, tt.err, tt.want)
+			}
+		}
+	})
+}
+
+// TestItemCodes creates items without a code at the same time; each must get
+// its own.
+func TestItemCodes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store repository.Store) {
+		const n = 10
+		codes := make([]string, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				item := entity.Item{Name: fmt.Sprint("Item ", i), Stock: 1, Status: entity.ItemActive}
+				if err := store.Items.Create(ctx, &item); err != nil {
+					t.Errorf("Create() = %v", err)
+				}
+				codes[i] = item.ItemCode
+			}(i)
+		}
+		wg.Wait()
+
+		sort.Strings(codes)
+		want := "[CODE011 CODE012 CODE013 CODE014 CODE015 CODE016 CODE017 CODE018 CODE019 CODE020]"
+		if fmt.Sprint(codes) != want {
+			t.Errorf("generated codes = %v, want %s", codes, want)
+		}
+		if item, err := store.Items.FindByCode(ctx, "CODE015"); err != nil || item.ItemCode != "CODE015" {
+			t.Errorf("FindByCode(CODE015) = %+v, %v", item, err)
+		}
+	})
+}
+
+func TestStock(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store repository.Store) {
+		// Item 5 starts with 10 in stock.
+		if item, err := store.Items.AdjustStock(ctx, 5, -11, "issued"); !errors.Is(err, repository.ErrInsufficientStock) || item.Stock != 10 {
+			t.Errorf("AdjustStock(-11) = %+v, %v; want ErrInsufficientStock and 10 in stock", item, err)
+		}
+		item, err := store.Items.AdjustStock(ctx, 5, -4, "issued")
+		if err != nil || item.Stock != 6 || item.Version != 2 {
+			t.Fatalf("AdjustStock(-4) = %+v, %v", item, err)
+		}
+
+		if _, err := store.Items.Transition(ctx, 5, 1, entity.ItemBroken, "dropped"); !errors.Is(err, repository.ErrStale) {
+			t.Errorf("Transition() of version 1 = %v, want ErrStale", err)
+		}
+		if _, err := store.Items.Transition(ctx, 5, 2, entity.ItemInRepair, "dropped"); !errors.Is(err, repository.ErrTransition) {
+			t.Errorf("Transition() from Active to InRepair = %v, want ErrTransition", err)
+		}
+		if item, err = store.Items.Transition(ctx, 5, 2, entity.ItemBroken, "dropped"); err != nil || item.Version != 3 {
+			t.Fatalf("Transition() = %+v, %v", item, err)
+		}
+
+		// Deleting keeps the ledger and closes it.
+		if err := store.Items.Delete(ctx, 5, 3); err != nil {
+			t.Fatal(err)
+		}
+		movements, _, err := store.Items.ListMovements(ctx, 5, repository.ListQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range movements {
+			got = append(got, fmt.Sprint(m.Delta, " ", m.Stock, " ", m.Reason, " ", m.Actor))
+		}
+		want := []string{"10 10 created tester", "-4 6 issued tester", "-6 0 deleted tester"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("movements = %q, want %q", got, want)
+		}
+		changes, _, err := store.Items.ListStatusHistory(ctx, 5, repository.ListQuery{})
+		if err != nil || len(changes) != 2 {
+			t.Errorf("status history after Delete() = %+v, %v; want 2 changes", changes, err)
+		}
+
+		if discrepancies, err := store.Items.Reconcile(ctx); err != nil || len(discrepancies) != 0 {
+			t.Errorf("Reconcile() = %v, %v; want no discrepancies", discrepancies, err)
+		}
+	})
+}
+
+func TestLoans(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store repository.Store) {
+		// Item 7 starts with 35 in stock; item 2 is Broken.
+		tooMany := entity.Loan{ItemID: 7, HeroID: 1, Quantity: 36, DueAt: "2999-01-01 00:00:00"}
+		if _, err := store.Loans.Checkout(ctx, &tooMany); !errors.Is(err, repository.ErrInsufficientStock) {
+			t.Errorf("Checkout() of 36 = %v, want ErrInsufficientStock", err)
+		}
+		broken := entity.Loan{ItemID: 2, HeroID: 1, Quantity: 1, DueAt: "2999-01-01 00:00:00"}
+		if _, err := store.Loans.Checkout(ctx, &broken); !errors.Is(err, repository.ErrUnavailable) {
+			t.Errorf("Checkout() of a Broken item = %v, want ErrUnavailable", err)
+		}
+		if _, total, err := store.Loans.List(ctx, repository.ListQuery{}); err != nil || total != 0 {
+			t.Fatalf("loans after failed checkouts: %d, %v; want none", total, err)
+		}
+
+		loan := entity.Loan{ItemID: 7, HeroID: 1, Quantity: 5, DueAt: "2999-01-01 00:00:00"}
+		item, err := store.Loans.Checkout(ctx, &loan)
+		if err != nil || item.Stock != 30 || loan.ID == 0 || loan.Status != entity.LoanOut {
+			t.Fatalf("Checkout() = %+v, %+v, %v", item, loan, err)
+		}
+		if err := store.Items.Delete(ctx, 7, item.Version); !errors.Is(err, repository.ErrConstraint) {
+			t.Errorf("Delete() of a lent item = %v, want ErrConstraint", err)
+		}
+
+		returned, err := store.Loans.Return(ctx, loan.ID, true)
+		if err != nil || returned.Status != entity.LoanBroken || returned.ReturnedAt == nil {
+			t.Fatalf("Return() = %+v, %v", returned, err)
+		}
+		if _, err := store.Loans.Return(ctx, loan.ID, false); !errors.Is(err, repository.ErrReturned) {
+			t.Errorf("Return() again = %v, want ErrReturned", err)
+		}
+		if item, err := store.Items.FindByID(ctx, 7); err != nil || item.Stock != 30 || item.Status != entity.ItemActive {
+			t.Errorf("item after broken return = %+v, %v; want 30 in stock and Active", item, err)
+		}
+
+		another := entity.Loan{ItemID: 7, HeroID: 2, Quantity: 30, DueAt: "2999-01-01 00:00:00"}
+		if _, err := store.Loans.Checkout(ctx, &another); err != nil {
+			t.Fatalf("Checkout() after broken return = %v", err)
+		}
+		if _, err := store.Loans.Return(ctx, another.ID, false); err != nil {
+			t.Fatal(err)
+		}
+
+		movements, _, err := store.Items.ListMovements(ctx, 7, repository.ListQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range movements {
+			got = append(got, fmt.Sprint(m.Delta, " ", m.Stock, " ", m.Reason))
+		}
+		want := []string{"35 35 created", "-5 30 checked out to hero 1 on loan 1", "0 30 5 returned broken by hero 1 on loan 1",
+			"-30 0 checked out to hero 2 on loan 2", "30 30 returned by hero 2 on loan 2"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("movements = %q, want %q", got, want)
+		}
+	})
+}
+
+// TestReconcile changes stock behind the ledger's back, which only the SQL
+// store allows.
+func TestReconcile(t *testing.T) {
+	store, db := openSQLite(t)
+
+	if _, err := db.ExecContext(ctx, `UPDATE item SET Stock = Stock + 3 WHERE ID IN (4, 9)`); err != nil {
+		t.Fatal(err)
+	}
+	discrepancies, err := store.Items.Reconcile(ctx)
+	want := []repository.StockDiscrepancy{{ItemID: 4, Stock: 43, Ledger: 40}, {ItemID: 9, Stock: 48, Ledger: 45}}
+	if err != nil || fmt.Sprint(discrepancies) != fmt.Sprint(want) {
+		t.Errorf("Reconcile() = %v, %v; want %v", discrepancies, err, want)
+	}
+}
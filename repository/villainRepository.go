@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"ngc4/entity"
+)
+
+type sqlVillainRepository struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func (r *sqlVillainRepository) FindAll(ctx context.Context) ([]entity.Villain, error) {
+	return r.selectRows(ctx, ListQuery{})
+}
+
+func (r *sqlVillainRepository) List(ctx context.Context, q ListQuery) ([]entity.Villain, int, error) {
+	total, err := r.dialect.count(ctx, r.db, "villain", q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	villain, err := r.selectRows(ctx, q)
+	return villain, total, err
+}
+
+func (r *sqlVillainRepository) selectRows(ctx context.Context, q ListQuery) ([]entity.Villain, error) {
+	var villain []entity.Villain
+
+	where, args := q.where("villain", false)
+	query := `SELECT ID, Version, Name, Universe, ImageURL FROM villain` + where + q.tail("villain")
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v := entity.Villain{}
+		err := rows.Scan(&v.ID, &v.Version, &v.Name, &v.Universe, &v.ImageURL)
+		if err != nil {
+			return nil, err
+		}
+		villain = append(villain, v)
+	}
+	return villain, rows.Err()
+}
+
+func (r *sqlVillainRepository) FindByID(ctx context.Context, id int) (entity.Villain, error) {
+	var villain entity.Villain
+
+	query := `
+		SELECT ID, Version, Name, Universe, ImageURL FROM villain
+		WHERE ID = ?
+	`
+
+	row := r.db.QueryRowContext(ctx, r.dialect.Rebind(query), id)
+	err := row.Scan(&villain.ID, &villain.Version, &villain.Name, &villain.Universe, &villain.ImageURL)
+	if err == sql.ErrNoRows {
+		return villain, ErrNotFound
+	}
+	return villain, err
+}
+
+func (r *sqlVillainRepository) Create(ctx context.Context, villain *entity.Villain) error {
+	id, err := r.dialect.insertRow(ctx, r.db, "villain", villain.ID,
+		[]string{"Name", "Universe", "ImageURL"},
+		villain.Name, villain.Universe, villain.ImageURL)
+	if err != nil {
+		return err
+	}
+
+	villain.ID = id
+	villain.Version = 1
+	return nil
+}
+
+func (r *sqlVillainRepository) Update(ctx context.Context, villain entity.Villain) error {
+	query := `
+        UPDATE villain
+        SET Name = ?, Universe = ?, ImageURL = ?, Version = Version + 1
+        WHERE ID = ? AND Version = ?
+    `
+	return r.dialect.execVersioned(ctx, r.db, "villain", villain.ID, query, villain.Name, villain.Universe, villain.ImageURL, villain.ID, villain.Version)
+}
+
+func (r *sqlVillainRepository) Delete(ctx context.Context, id, version int) error {
+	query := `
+        DELETE FROM villain
+        WHERE ID = ? AND Version = ?
+    `
+	return r.dialect.execVersioned(ctx, r.db, "villain", id, query, id, version)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"ngc4/repository"
+	"ngc4/seed"
+	"sort"
+)
+
+// seedFixtures implements "ngc4 seed file...". Files are applied in order
+// and each may be rerun without duplicating rows.
+func seedFixtures(paths []string) {
+	if len(paths) == 0 {
+		log.Fatal("seed needs at least one fixture file, e.g. seed/fixtures/demo.json")
+	}
+	if cfg.Storage == "memory" {
+		log.Fatal("seed needs a SQL backend; the memory store is empty on every start")
+	}
+
+	db, dialect, err := openDB()
+	if err != nil {
+		log.Fatal("Failed connecting to Database: ", err)
+	}
+	defer db.Close()
+
+	store := repository.NewSQLStore(db, dialect, itemCodes())
+	ctx := repository.WithActor(context.Background(), "seed")
+
+	for _, path := range paths {
+		fixtures, err := seed.LoadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		res, err := seed.Apply(ctx, store, fixtures)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+
+		kinds := map[string]bool{}
+		for _, m := range []map[string]int{res.Created, res.Updated, res.Unchanged} {
+			for kind := range m {
+				kinds[kind] = true
+			}
+		}
+		names := make([]string, 0, len(kinds))
+		for kind := range kinds {
+			names = append(names, kind)
+		}
+		sort.Strings(names)
+
+		fmt.Println(path)
+		for _, kind := range names {
+			fmt.Printf("  %-13s %d created, %d updated, %d unchanged\n",
+				kind, res.Created[kind], res.Updated[kind], res.Unchanged[kind])
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ngc4/entity"
+	"ngc4/repository"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CrimeEvent is a crime event fixture. Besides HeroID and VillainID it may
+// name the hero and villain, which lets fixtures refer to rows whose IDs are
+// generated while seeding.
+type CrimeEvent struct {
+	entity.CrimeEvent
+	Hero    string
+	Villain string
+}
+
+// Fixtures is the content of one fixture file. Keys match the JSON field
+// names of the entities, in both JSON and YAML files.
+type Fixtures struct {
+	Heroes      []entity.Heroes  `json:"heroes"`
+	Villains    []entity.Villain `json:"villains"`
+	CrimeEvents []CrimeEvent     `json:"crime_events"`
+	Items       []entity.Item    `json:"items"`
+}
+
+// LoadFile reads fixtures from a .json, .yaml or .yml file.
+func LoadFile(path string) (Fixtures, error) {
+	var f Fixtures
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		// Go through JSON so YAML keys follow the same rules as JSON ones
+		// instead of yaml.v3's lower-cased field names.
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return f, fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return f, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return f, fmt.Errorf("%s: fixtures must be .json, .yaml or .yml", path)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return f, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Result counts what Apply did per entity.
+type Result struct {
+	Created   map[string]int
+	Updated   map[string]int
+	Unchanged map[string]int
+}
+
+// upsert stores row under id: it is created when id is zero or unknown,
+// updated when it differs from the stored row and left alone otherwise.
+func upsert[T comparable](ctx context.Context, res Result, kind string, id int, row *T,
+	find func(context.Context, int) (T, error),
+	create func(context.Context, *T) error,
+	update func(context.Context, T) error,
+) error {
+	existing, err := find(ctx, id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		res.Created[kind]++
+		return create(ctx, row)
+	case err != nil:
+		return err
+	}
+
+	// Fixtures carry no Version; take the stored one so that it neither
+	// counts as a difference nor makes the update stale.
+	version := reflect.ValueOf(existing).FieldByName("Version")
+	reflect.ValueOf(row).Elem().FieldByName("Version").Set(version)
+
+	switch {
+	case existing == *row:
+		res.Unchanged[kind]++
+		return nil
+	default:
+		res.Updated[kind]++
+		return update(ctx, *row)
+	}
+}
+
+// Apply writes fixtures to the store and can be rerun safely. A fixture with
+// an ID is stored under that ID; one without is matched on its natural key
+// (hero and villain Name, item ItemCode, crime event hero, villain, DateTime
+// and Description) so that a second run updates instead of duplicating it.
+// Crime events are only written once every hero and villain they reference
+// has been found. Items need an ItemCode: the store would generate a new one
+// for an item without, so every run would add another copy.
+func Apply(ctx context.Context, store repository.Store, f Fixtures) (Result, error) {
+	res := Result{Created: map[string]int{}, Updated: map[string]int{}, Unchanged: map[string]int{}}
+
+	var missing []string
+	for i, item := range f.Items {
+		if item.ItemCode == "" {
+			missing = append(missing, fmt.Sprintf("items[%d] (%q)", i, item.Name))
+		}
+	}
+	if len(missing) > 0 {
+		return res, fmt.Errorf("items without ItemCode: %s", strings.Join(missing, ", "))
+	}
+
+	heroes, err := store.Heroes.FindAll(ctx)
+	if err != nil {
+		return res, err
+	}
+	heroIDs := map[string]int{}
+	for _, hero := range heroes {
+		heroIDs[hero.Name] = hero.ID
+	}
+	for _, hero := range f.Heroes {
+		if hero.ID == 0 {
+			hero.ID = heroIDs[hero.Name]
+		}
+		err := upsert(ctx, res, "heroes", hero.ID, &hero,
+			store.Heroes.FindByID, store.Heroes.Create, store.Heroes.Update)
+		if err != nil {
+			return res, fmt.Errorf("hero %q: %w", hero.Name, err)
+		}
+		heroIDs[hero.Name] = hero.ID
+	}
+
+	villains, err := store.Villains.FindAll(ctx)
+	if err != nil {
+		return res, err
+	}
+	villainIDs := map[string]int{}
+	for _, villain := range villains {
+		villainIDs[villain.Name] = villain.ID
+	}
+	for _, villain := range f.Villains {
+		if villain.ID == 0 {
+			villain.ID = villainIDs[villain.Name]
+		}
+		err := upsert(ctx, res, "villains", villain.ID, &villain,
+			store.Villains.FindByID, store.Villains.Create, store.Villains.Update)
+		if err != nil {
+			return res, fmt.Errorf("villain %q: %w", villain.Name, err)
+		}
+		villainIDs[villain.Name] = villain.ID
+	}
+
+	events, err := resolveCrimeEvents(ctx, store, f.CrimeEvents, heroIDs, villainIDs)
+	if err != nil {
+		return res, err
+	}
+	existingEvents, err := store.CrimeEvents.FindAll(ctx)
+	if err != nil {
+		return res, err
+	}
+	for _, ce := range events {
+		if ce.ID == 0 {
+			for _, e := range existingEvents {
+				if e.HeroID == ce.HeroID && e.VillainID == ce.VillainID && e.DateTime == ce.DateTime && e.Description == ce.Description {
+					ce.ID = e.ID
+					break
+				}
+			}
+		}
+		err := upsert(ctx, res, "crime_events", ce.ID, &ce,
+			store.CrimeEvents.FindByID, store.CrimeEvents.Create, store.CrimeEvents.Update)
+		if err != nil {
+			return res, fmt.Errorf("crime event %q: %w", ce.Description, err)
+		}
+	}
+
+	items, err := store.Items.FindAll(ctx)
+	if err != nil {
+		return res, err
+	}
+	itemIDs := map[string]int{}
+	for _, item := range items {
+		itemIDs[item.ItemCode] = item.ID
+	}
+	for _, item := range f.Items {
+		if item.ID == 0 {
+			item.ID = itemIDs[item.ItemCode]
+		}
+		err := upsert(ctx, res, "items", item.ID, &item,
+			store.Items.FindByID, store.Items.Create, store.Items.Update)
+		if err != nil {
+			return res, fmt.Errorf("item %q: %w", item.ItemCode, err)
+		}
+		itemIDs[item.ItemCode] = item.ID
+	}
+
+	return res, nil
+}
+
+// resolveCrimeEvents turns hero and villain names into IDs and checks that
+// every referenced row exists, reporting all broken references at once.
+func resolveCrimeEvents(ctx context.Context, store repository.Store, fixtures []CrimeEvent, heroIDs, villainIDs map[string]int) ([]entity.CrimeEvent, error) {
+	var events []entity.CrimeEvent
+	var problems []string
+
+	for i, f := range fixtures {
+		ce := f.CrimeEvent
+
+		if f.Hero != "" {
+			id, ok := heroIDs[f.Hero]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("crime_events[%d]: unknown hero %q", i, f.Hero))
+			}
+			ce.HeroID = id
+		} else if _, err := store.Heroes.FindByID(ctx, ce.HeroID); err != nil {
+			problems = append(problems, fmt.Sprintf("crime_events[%d]: hero %d: %v", i, ce.HeroID, err))
+		}
+
+		if f.Villain != "" {
+			id, ok := villainIDs[f.Villain]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("crime_events[%d]: unknown villain %q", i, f.Villain))
+			}
+			ce.VillainID = id
+		} else if _, err := store.Villains.FindByID(ctx, ce.VillainID); err != nil {
+			problems = append(problems, fmt.Sprintf("crime_events[%d]: villain %d: %v", i, ce.VillainID, err))
+		}
+
+		events = append(events, ce)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("broken crime event references:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return events, nil
+}
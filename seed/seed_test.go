@@ -0,0 +1,112 @@
+package seed_test
+
+import (
+	"context"
+	"fmt"
+	"ngc4/entity"
+	"ngc4/repository"
+	"ngc4/seed"
+	"strings"
+	"testing"
+)
+
+// load reads the fixture files the repository ships.
+func load(t *testing.T) []seed.Fixtures {
+	t.Helper()
+	var all []seed.Fixtures
+	for _, path := range []string{"fixtures/demo.json", "fixtures/example.yaml"} {
+		f, err := seed.LoadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, f)
+	}
+	return all
+}
+
+// TestApplyTwice seeds the same fixtures twice; the second run must find
+// every row the first one created.
+func TestApplyTwice(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore(repository.DefaultItemCodes)
+
+	var first, second []seed.Result
+	for _, f := range load(t) {
+		res, err := seed.Apply(ctx, store, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first = append(first, res)
+	}
+	for _, f := range load(t) {
+		res, err := seed.Apply(ctx, store, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second = append(second, res)
+	}
+
+	for i := range first {
+		if len(second[i].Created) != 0 || len(second[i].Updated) != 0 {
+			t.Errorf("file %d: second run created %v and updated %v, want neither", i, second[i].Created, second[i].Updated)
+		}
+		if fmt.Sprint(second[i].Unchanged) != fmt.Sprint(first[i].Created) {
+			t.Errorf("file %d: second run left %v unchanged, want the %v created by the first", i, second[i].Unchanged, first[i].Created)
+		}
+	}
+
+	items, err := store.Items.FindAll(ctx)
+	if err != nil || len(items) != 10 {
+		t.Errorf("items after two runs = %d, %v; want 10", len(items), err)
+	}
+}
+
+// TestApplyUpdates changes a fixture between runs and checks that the row is
+// updated in place.
+func TestApplyUpdates(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore(repository.DefaultItemCodes)
+	f := load(t)[0]
+
+	if _, err := seed.Apply(ctx, store, f); err != nil {
+		t.Fatal(err)
+	}
+	f.Items[0].Stock = 7
+	res, err := seed.Apply(ctx, store, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Updated["items"] != 1 || len(res.Created) != 0 {
+		t.Errorf("second run created %v and updated %v, want one item updated", res.Created, res.Updated)
+	}
+
+	item, err := store.Items.FindByCode(ctx, f.Items[0].ItemCode)
+	if err != nil || item.Stock != 7 {
+		t.Errorf("FindByCode(%q) = %+v, %v; want Stock 7", f.Items[0].ItemCode, item, err)
+	}
+}
+
+// TestApplyItemWithoutCode refuses fixture items that a rerun could not
+// find, before writing anything.
+func TestApplyItemWithoutCode(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore(repository.DefaultItemCodes)
+
+	f := seed.Fixtures{
+		Heroes: []entity.Heroes{{Name: "Thor", Universe: "Marvel"}},
+		Items: []entity.Item{
+			{Name: "Mjolnir", ItemCode: "MJOLNIR", Stock: 1, Status: "Active"},
+			{Name: "Stormbreaker", Stock: 1, Status: "Active"},
+		},
+	}
+	_, err := seed.Apply(ctx, store, f)
+	if err == nil || !strings.Contains(err.Error(), `items[1] ("Stormbreaker")`) {
+		t.Fatalf("Apply() = %v, want an error naming items[1]", err)
+	}
+
+	heroes, _ := store.Heroes.FindAll(ctx)
+	items, _ := store.Items.FindAll(ctx)
+	if len(heroes) != 0 || len(items) != 0 {
+		t.Errorf("Apply() wrote %d heroes and %d items before failing", len(heroes), len(items))
+	}
+}
@@ -0,0 +1,169 @@
+// Package validate checks structs against rules declared in `validate`
+// struct tags, e.g.
+//
+//	Name  string `validate:"required,max=255"`
+//	Stock int    `validate:"min=0"`
+//
+// Supported rules:
+//
+//	required   strings must be non-empty, numbers non-zero
+//	min=N      minimum string length or numeric value
+//	max=N      maximum string length or numeric value
+//	oneof=A B  the value must be one of the space separated options
+//	datetime   the string must be a "YYYY-MM-DD HH:MM:SS" timestamp
+//
+// Rules other than required are skipped for empty values, so optional
+// fields are only checked when present. A pointer is checked as the value it
+// points to; a nil one is empty.
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DateTimeLayout is the format accepted by the datetime rule; it matches
+// what MySQL returns for DATETIME columns.
+const DateTimeLayout = "2006-01-02 15:04:05"
+
+// FieldError describes one rule a field failed.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors is every rule a value failed, in field order.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Struct validates v, a struct or pointer to one, and returns Errors when any
+// rule fails. Embedded structs are validated as part of v. A malformed tag
+// panics, since it is a programming error.
+func Struct(v any) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: %T is not a struct", v))
+	}
+
+	var errs Errors
+	checkStruct(rv, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkStruct(rv reflect.Value, errs *Errors) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			checkStruct(rv.Field(i), errs)
+			continue
+		}
+
+		tag := sf.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := fieldName(sf)
+		for _, rule := range strings.Split(tag, ",") {
+			if msg := check(rv.Field(i), rule); msg != "" {
+				key, _, _ := strings.Cut(rule, "=")
+				*errs = append(*errs, FieldError{Field: name, Rule: key, Message: msg})
+				break
+			}
+		}
+	}
+}
+
+// fieldName is the name the field has in JSON documents.
+func fieldName(sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return sf.Name
+}
+
+// check returns a message when v fails rule, or "" when it passes.
+func check(v reflect.Value, rule string) string {
+	key, arg, _ := strings.Cut(rule, "=")
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
+		}
+	}
+
+	if key == "required" {
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+	if v.IsZero() {
+		return ""
+	}
+
+	switch key {
+	case "min", "max":
+		limit, err := strconv.Atoi(arg)
+		if err != nil {
+			panic(fmt.Sprintf("validate: bad %s argument %q", key, arg))
+		}
+		n, unit := measure(v)
+		if key == "min" && n < limit {
+			return fmt.Sprintf("must be at least %d%s", limit, unit)
+		}
+		if key == "max" && n > limit {
+			return fmt.Sprintf("must be at most %d%s", limit, unit)
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		s := fmt.Sprint(v.Interface())
+		for _, o := range options {
+			if s == o {
+				return ""
+			}
+		}
+		quoted, _ := json.Marshal(options)
+		return "must be one of " + string(quoted)
+	case "datetime":
+		if _, err := time.Parse(DateTimeLayout, v.String()); err != nil {
+			return "must be a date and time formatted as YYYY-MM-DD HH:MM:SS"
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q", key))
+	}
+	return ""
+}
+
+// measure returns the length of a string or the value of a number.
+func measure(v reflect.Value) (int, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), " characters"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), ""
+	default:
+		panic(fmt.Sprintf("validate: min/max on unsupported kind %s", v.Kind()))
+	}
+}
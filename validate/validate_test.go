@@ -0,0 +1,184 @@
+package validate_test
+
+import (
+	"encoding/json"
+	"ngc4/validate"
+	"reflect"
+	"testing"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+type (
+	required struct {
+		Name     string  `validate:"required"`
+		Count    int     `validate:"required"`
+		Nickname *string `validate:"required"`
+	}
+	lengths struct {
+		Code string `validate:"min=2,max=5"`
+	}
+	numbers struct {
+		Stock   int  `validate:"min=0,max=10"`
+		Reorder *int `validate:"min=1"`
+	}
+	options struct {
+		Status    string  `validate:"oneof=Active Broken"`
+		Condition *string `validate:"oneof=Good Broken"`
+		Level     int     `validate:"oneof=1 2"`
+	}
+	dateTime struct {
+		DueAt    string  `validate:"datetime"`
+		ReturnAt *string `validate:"datetime"`
+	}
+	// firstFailure stops at the first rule a field fails.
+	firstFailure struct {
+		Name string `validate:"required,max=3"`
+	}
+	named struct {
+		Code    string `json:"item_code" validate:"required"`
+		Skipped string `json:"-" validate:"required"`
+		Options string `json:",omitempty" validate:"required"`
+		private string `validate:"required"`
+		Free    string
+	}
+)
+
+// Base is embedded by withBase; its fields are checked first, in order.
+type Base struct {
+	ID int `validate:"min=1"`
+}
+
+type withBase struct {
+	Base
+	Name string `validate:"required"`
+}
+
+func TestStruct(t *testing.T) {
+	fe := func(field, rule, message string) validate.FieldError {
+		return validate.FieldError{Field: field, Rule: rule, Message: message}
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		want  validate.Errors
+	}{
+		{"required set", required{Name: "Thor", Count: 1, Nickname: ptr("Point Break")}, nil},
+		{"required pointer to empty", required{Name: "Thor", Count: 1, Nickname: ptr("")}, validate.Errors{
+			fe("Nickname", "required", "is required"),
+		}},
+		{"required empty", required{}, validate.Errors{
+			fe("Name", "required", "is required"),
+			fe("Count", "required", "is required"),
+			fe("Nickname", "required", "is required"),
+		}},
+
+		{"min and max in range", lengths{Code: "CODE1"}, nil},
+		{"length counts characters", lengths{Code: "héllo"}, nil},
+		{"too short", lengths{Code: "C"}, validate.Errors{fe("Code", "min", "must be at least 2 characters")}},
+		{"too long", lengths{Code: "CODE12"}, validate.Errors{fe("Code", "max", "must be at most 5 characters")}},
+		{"empty skips min", lengths{}, nil},
+
+		{"numbers in range", numbers{Stock: 10, Reorder: ptr(1)}, nil},
+		{"below min", numbers{Stock: -1}, validate.Errors{fe("Stock", "min", "must be at least 0")}},
+		{"above max", numbers{Stock: 11}, validate.Errors{fe("Stock", "max", "must be at most 10")}},
+		{"nil pointer skips min", numbers{Reorder: nil}, nil},
+		{"pointer to zero skips min", numbers{Reorder: ptr(0)}, nil},
+		{"pointer below min", numbers{Reorder: ptr(-2)}, validate.Errors{fe("Reorder", "min", "must be at least 1")}},
+
+		{"options", options{Status: "Broken", Condition: ptr("Good"), Level: 2}, nil},
+		{"empty skips oneof", options{}, nil},
+		{"not an option", options{Status: "Lost", Condition: ptr("Lost"), Level: 3}, validate.Errors{
+			fe("Status", "oneof", `must be one of ["Active","Broken"]`),
+			fe("Condition", "oneof", `must be one of ["Good","Broken"]`),
+			fe("Level", "oneof", `must be one of ["1","2"]`),
+		}},
+
+		{"datetime", dateTime{DueAt: "2023-12-20 10:00:00", ReturnAt: ptr("2023-12-21 09:30:00")}, nil},
+		{"nil pointer skips datetime", dateTime{DueAt: "2023-12-20 10:00:00"}, nil},
+		{"not a datetime", dateTime{DueAt: "2023-12-20T10:00:00Z", ReturnAt: ptr("tomorrow")}, validate.Errors{
+			fe("DueAt", "datetime", "must be a date and time formatted as YYYY-MM-DD HH:MM:SS"),
+			fe("ReturnAt", "datetime", "must be a date and time formatted as YYYY-MM-DD HH:MM:SS"),
+		}},
+
+		{"first failing rule only", firstFailure{}, validate.Errors{fe("Name", "required", "is required")}},
+		{"pointer to struct", &firstFailure{Name: "Loki"}, validate.Errors{fe("Name", "max", "must be at most 3 characters")}},
+
+		{"json names", named{private: "x"}, validate.Errors{
+			fe("item_code", "required", "is required"),
+			fe("Skipped", "required", "is required"),
+			fe("Options", "required", "is required"),
+		}},
+
+		{"embedded", withBase{Base: Base{ID: 1}, Name: "Hulk"}, nil},
+		{"embedded fields first", withBase{Base: Base{ID: -1}}, validate.Errors{
+			fe("ID", "min", "must be at least 1"),
+			fe("Name", "required", "is required"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate.Struct(tt.value)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Struct(%+v) = %v, want nil", tt.value, err)
+				}
+				return
+			}
+			if got, ok := err.(validate.Errors); !ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct(%+v) = %#v, want %#v", tt.value, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestErrors checks the two forms errors are reported in: the message of
+// the error and the details of a 422 response.
+func TestErrors(t *testing.T) {
+	err := validate.Struct(withBase{Base: Base{ID: -1}})
+	if want := "ID: must be at least 1; Name: is required"; err == nil || err.Error() != want {
+		t.Errorf("Error() = %v, want %q", err, want)
+	}
+
+	details, _ := json.Marshal(validate.Struct(required{Name: "Thor", Count: 1}))
+	const want = `[{"field":"Nickname","rule":"required","message":"is required"}]`
+	if string(details) != want {
+		t.Errorf("json = %s, want %s", details, want)
+	}
+}
+
+// TestMisuse checks that mistakes in the tags or the argument panic.
+func TestMisuse(t *testing.T) {
+	type (
+		unknownRule struct {
+			Name string `validate:"uppercase"`
+		}
+		badArgument struct {
+			Name string `validate:"max=ten"`
+		}
+		unsupportedKind struct {
+			Tags []string `validate:"max=3"`
+		}
+	)
+
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"not a struct", "Thor"},
+		{"unknown rule", unknownRule{Name: "Thor"}},
+		{"bad argument", badArgument{Name: "Thor"}},
+		{"unsupported kind", unsupportedKind{Tags: []string{"a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Struct(%+v) did not panic", tt.value)
+				}
+			}()
+			validate.Struct(tt.value)
+		})
+	}
+}